@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Roles of users. HR may do everything. A department head sees only the
+// workers and statistics of their departments, salaries included. A
+// receptionist sees every worker's contact details but never salaries or
+// license numbers. Only HR changes data.
+const (
+	roleHR             = "hr"
+	roleDepartmentHead = "department_head"
+	roleReceptionist   = "receptionist"
+)
+
+var roles = []string{roleHR, roleDepartmentHead, roleReceptionist}
+
+type permission string
+
+const (
+	permEditWorkers     permission = "edit_workers"
+	permEditDepartments permission = "edit_departments"
+	permEditReferences  permission = "edit_references"
+	permViewSalaries    permission = "view_salaries"
+	permViewAudit       permission = "view_audit"
+	permManageTokens    permission = "manage_tokens"
+)
+
+var rolePermissions = map[string][]permission{
+	roleHR:             {permEditWorkers, permEditDepartments, permEditReferences, permViewSalaries, permViewAudit, permManageTokens},
+	roleDepartmentHead: {permViewSalaries},
+	roleReceptionist:   {},
+}
+
+func validRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+func (sess *Session) can(p permission) bool {
+	for _, granted := range rolePermissions[sess.Role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// scoped reports whether the session sees only its own departments.
+func (sess *Session) scoped() bool {
+	return sess.Role != roleHR && sess.Role != roleReceptionist
+}
+
+func (sess *Session) seesDepartment(id int) bool {
+	if !sess.scoped() {
+		return true
+	}
+	for _, dept := range sess.DepartmentIDs {
+		if dept == id {
+			return true
+		}
+	}
+	return false
+}
+
+// scope limits list filters to the departments of the session.
+func (sess *Session) scope(filters Filters) Filters {
+	if sess.scoped() {
+		filters["department_ids"] = sess.DepartmentIDs
+	}
+	return filters
+}
+
+// allowed writes 403 and returns false when the caller lacks p.
+func allowed(w http.ResponseWriter, r *http.Request, p permission) bool {
+	if currentSession(r.Context()).can(p) {
+		return true
+	}
+	writeError(w, r, forbidden())
+	return false
+}
+
+// salaryParams are the worker list parameters that would reveal salaries or
+// license numbers, through the filter or the sort order and its cursor.
+var salaryParams = map[string]bool{"salary_min": true, "salary_max": true}
+
+var salarySortColumns = map[string]bool{"salary": true, "license_number": true}
+
+// checkWorkerQuery rejects filtering and sorting by hidden columns.
+func (sess *Session) checkWorkerQuery(filters Filters, page *pageRequest) error {
+	if sess.can(permViewSalaries) {
+		return nil
+	}
+	var errs FieldErrors
+	for name := range filters {
+		if salaryParams[name] {
+			errs = append(errs, FieldError{Field: name, Message: "is not permitted for your role"})
+		}
+	}
+	for _, k := range page.sort {
+		if salarySortColumns[k.column] {
+			errs = append(errs, FieldError{Field: "sort", Message: fmt.Sprintf("by %s is not permitted for your role", k.column)})
+		}
+	}
+	return errs.orNil()
+}
+
+// redactedWorker hides the salary and license number of a worker: the
+// fields shadow those of the embedded worker and are left out when nil.
+type redactedWorker struct {
+	*MedicalWorker
+	Salary        *float64 `json:"salary,omitempty"`
+	LicenseNumber *string  `json:"license_number,omitempty"`
+}
+
+// worker returns mw as the session may see it in JSON.
+func (sess *Session) worker(mw *MedicalWorker) interface{} {
+	if sess.can(permViewSalaries) {
+		return mw
+	}
+	return redactedWorker{MedicalWorker: mw}
+}
+
+func (sess *Session) workers(list []MedicalWorker) interface{} {
+	if sess.can(permViewSalaries) {
+		return list
+	}
+	redacted := make([]redactedWorker, len(list))
+	for i := range list {
+		redacted[i] = redactedWorker{MedicalWorker: &list[i]}
+	}
+	return redacted
+}
+
+// history drops the versions from other departments and hides salaries.
+func (sess *Session) history(versions []WorkerVersion) []WorkerVersion {
+	visible := []WorkerVersion{}
+	for _, v := range versions {
+		if !sess.seesDepartment(v.DepartmentID) {
+			continue
+		}
+		if !sess.can(permViewSalaries) {
+			v.Salary, v.LicenseNumber = nil, nil
+		}
+		visible = append(visible, v)
+	}
+	return visible
+}
+
+func (sess *Session) departmentStats(stats []DepartmentStat) []DepartmentStat {
+	visible := []DepartmentStat{}
+	for _, st := range stats {
+		if !sess.seesDepartment(st.DepartmentID) {
+			continue
+		}
+		if !sess.can(permViewSalaries) {
+			st.AvgSalary, st.MinSalary, st.MaxSalary, st.TotalSalaryBudget = nil, nil, nil, nil
+		}
+		visible = append(visible, st)
+	}
+	return visible
+}
+
+// reportSheet drops the salary and license columns and the rows of other
+// departments from a sheet of the Excel report. Lookup tables have no
+// department and are kept whole.
+func (sess *Session) reportSheet(sheet ReportSheet) ReportSheet {
+	var keep []int
+	deptCol := -1
+	for i, col := range sheet.Columns {
+		if col == "department_id" {
+			deptCol = i
+		}
+		if !sess.can(permViewSalaries) && (strings.Contains(col, "salary") || col == "license_number") {
+			continue
+		}
+		keep = append(keep, i)
+	}
+	out := ReportSheet{Name: sheet.Name}
+	for _, i := range keep {
+		out.Columns = append(out.Columns, sheet.Columns[i])
+		out.Types = append(out.Types, sheet.Types[i])
+	}
+	for _, row := range sheet.Rows {
+		if deptCol >= 0 && !sess.seesDepartment(intValue(row[deptCol])) {
+			continue
+		}
+		kept := make([]interface{}, len(keep))
+		for j, i := range keep {
+			kept[j] = row[i]
+		}
+		out.Rows = append(out.Rows, kept)
+	}
+	return out
+}
+
+// intValue converts an integer column value as returned by the drivers.
+func intValue(v interface{}) int {
+	switch n := v.(type) {
+	case int64:
+		return int(n)
+	case int32:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tealeg/xlsx"
+)
+
+// hiddenKeys returns the keys of a JSON object that a receptionist must
+// not receive.
+func hiddenKeys(obj map[string]interface{}) []string {
+	var keys []string
+	for key := range obj {
+		if strings.Contains(key, "salary") || key == "license_number" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func getObjects(t *testing.T, c *testClient, path string) []map[string]interface{} {
+	t.Helper()
+	status, body := c.do("GET", path, "")
+	if status != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", path, status, body)
+	}
+	var list []map[string]interface{}
+	if err := json.Unmarshal(body, &list); err != nil {
+		var obj map[string]interface{}
+		if json.Unmarshal(body, &obj) != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		list = append(list, obj)
+	}
+	return list
+}
+
+// getReport downloads the Excel report and returns its sheets by name.
+func getReport(t *testing.T, c *testClient) map[string]*xlsx.Sheet {
+	t.Helper()
+	status, body := c.do("GET", "/api/download-report", "")
+	if status != http.StatusOK {
+		t.Fatalf("report: %d %s", status, body)
+	}
+	file, err := xlsx.OpenBinary(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.Sheet
+}
+
+// sheetColumn returns the index of a column of a report sheet, -1 when the
+// sheet does not have it.
+func sheetColumn(sheet *xlsx.Sheet, name string) int {
+	for i, cell := range sheet.Rows[0].Cells {
+		if cell.Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// moveWorker moves a worker to another department, leaving a version in
+// the old one in its history.
+func moveWorker(t *testing.T, store *sqlStore, id, departmentID int) {
+	t.Helper()
+	ctx := withActor(context.Background(), "test")
+	mw, err := store.GetWorker(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := mw.input()
+	in.DepartmentID = departmentID
+	if err := store.UpdateWorker(ctx, id, &in, mw.RowVersion); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDepartmentHeadSeesOwnDepartments(t *testing.T) {
+	ts := newTestServer(t)
+	var own, other int
+	err := ts.store.db.QueryRow(`SELECT MIN(CASE WHEN department_id = 1 THEN worker_id END),
+		MIN(CASE WHEN department_id = 2 THEN worker_id END) FROM medical_workers`).Scan(&own, &other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := ts.login(t, "head")
+
+	for _, path := range []string{
+		"/api/medical-workers/" + strconv.Itoa(other),
+		"/api/medical-workers/" + strconv.Itoa(other) + "/history",
+		"/api/department-details/2",
+		"/api/departments/2/statistics",
+	} {
+		if status, body := head.do("GET", path, ""); status != http.StatusNotFound {
+			t.Errorf("GET %s: %d %s, want 404", path, status, body)
+		}
+	}
+	for _, path := range []string{
+		"/api/medical-workers/" + strconv.Itoa(own),
+		"/api/medical-workers/" + strconv.Itoa(own) + "/history",
+		"/api/department-details/1",
+		"/api/departments/1/statistics",
+	} {
+		if status, body := head.do("GET", path, ""); status != http.StatusOK {
+			t.Errorf("GET %s: %d %s, want 200", path, status, body)
+		}
+	}
+
+	for _, path := range []string{
+		"/api/medical-workers",
+		"/api/medical-workers?department_id=2",
+		"/api/medical-workers?sort=department_id:desc",
+		"/api/all-departments",
+		"/api/department-statistics",
+	} {
+		list := getObjects(t, head, path)
+		for _, obj := range list {
+			if obj["department_id"] != 1.0 {
+				t.Errorf("GET %s listed department %v", path, obj["department_id"])
+			}
+		}
+		if want := !strings.Contains(path, "department_id=2"); want != (len(list) > 0) {
+			t.Errorf("GET %s listed %d items", path, len(list))
+		}
+	}
+
+	// A worker moved in keeps its history elsewhere to itself.
+	moveWorker(t, ts.store, other, 1)
+	versions := getObjects(t, head, "/api/medical-workers/"+strconv.Itoa(other)+"/history")
+	if len(versions) != 1 || versions[0]["department_id"] != 1.0 {
+		t.Errorf("history of a moved worker: %v", versions)
+	}
+	if all := getObjects(t, ts.login(t, "hr"), "/api/medical-workers/"+strconv.Itoa(other)+"/history"); len(all) != 2 {
+		t.Errorf("HR sees %d versions, want 2", len(all))
+	}
+
+	for name, sheet := range getReport(t, head) {
+		col := sheetColumn(sheet, "department_id")
+		if col < 0 {
+			continue
+		}
+		if len(sheet.Rows) < 2 {
+			t.Errorf("sheet %s has no rows", name)
+		}
+		for _, row := range sheet.Rows[1:] {
+			if row.Cells[col].Value != "1" {
+				t.Errorf("sheet %s has a row of department %s", name, row.Cells[col].Value)
+			}
+		}
+		if name == "Medical Workers View" && sheetColumn(sheet, "salary") < 0 {
+			t.Errorf("sheet %s has no salaries for a department head", name)
+		}
+	}
+}
+
+func TestReceptionistSeesNoSalaries(t *testing.T) {
+	ts := newTestServer(t)
+	moveWorker(t, ts.store, 1, 2)
+	reception := ts.login(t, "reception")
+
+	for _, path := range []string{
+		"/api/medical-workers/1",
+		"/api/medical-workers",
+		"/api/medical-workers?include_archived=true",
+		"/api/medical-workers/1/history",
+		"/api/department-statistics",
+		"/api/departments/1/statistics",
+	} {
+		list := getObjects(t, reception, path)
+		if len(list) == 0 {
+			t.Errorf("GET %s returned nothing", path)
+		}
+		for _, obj := range list {
+			if keys := hiddenKeys(obj); len(keys) != 0 {
+				t.Errorf("GET %s returned %v", path, keys)
+			}
+		}
+		// A receptionist sees every department.
+		if path == "/api/medical-workers" && len(list) != 14 {
+			t.Errorf("GET %s listed %d workers, want 14", path, len(list))
+		}
+	}
+	for _, path := range []string{
+		"/api/medical-workers?salary_min=1",
+		"/api/medical-workers?salary_max=100000",
+		"/api/medical-workers?sort=salary",
+		"/api/medical-workers?sort=license_number:desc",
+	} {
+		if status, body := reception.do("GET", path, ""); status != http.StatusBadRequest {
+			t.Errorf("GET %s: %d %s, want 400", path, status, body)
+		}
+	}
+
+	for name, sheet := range getReport(t, reception) {
+		for _, cell := range sheet.Rows[0].Cells {
+			if strings.Contains(cell.Value, "salary") || cell.Value == "license_number" {
+				t.Errorf("sheet %s has column %s", name, cell.Value)
+			}
+		}
+	}
+
+	// HR sees them, so the checks above look at the right fields.
+	hr := ts.login(t, "hr")
+	if keys := hiddenKeys(getObjects(t, hr, "/api/medical-workers/1")[0]); len(keys) != 2 {
+		t.Errorf("HR got %v", keys)
+	}
+	if sheet := getReport(t, hr)["Medical Workers"]; sheetColumn(sheet, "salary") < 0 || sheetColumn(sheet, "license_number") < 0 {
+		t.Error("HR report has no salaries")
+	}
+}
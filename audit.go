@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Audited entity names, as stored in audit_log.entity.
+const (
+	auditWorker         = "worker"
+	auditDepartment     = "department"
+	auditFacilityType   = "facility_type"
+	auditSpecialization = "specialization"
+)
+
+var auditEntities = []string{auditWorker, auditDepartment, auditFacilityType, auditSpecialization}
+
+// withActor records who makes the changes of a request.
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// actor returns the actor of ctx, "anonymous" when nobody is known.
+func actor(ctx context.Context) string {
+	if a, ok := ctx.Value(actorKey).(string); ok && a != "" {
+		return a
+	}
+	return "anonymous"
+}
+
+// auditedStore wraps the stores and records every successful change in the
+// audit log with the record before and after it. The change, both reads and
+// the audit entry share one transaction, so a change is only made together
+// with its entry and the records cannot change in between.
+type auditedStore struct {
+	WorkerStore
+	DepartmentStore
+	ReferenceStore
+	audit AuditStore
+	tx    TxStore
+}
+
+func newAuditedStore(workers WorkerStore, departments DepartmentStore, refs ReferenceStore, audit AuditStore, tx TxStore) *auditedStore {
+	return &auditedStore{WorkerStore: workers, DepartmentStore: departments, ReferenceStore: refs, audit: audit, tx: tx}
+}
+
+func (a *auditedStore) record(ctx context.Context, entity string, id int, action string, before, after interface{}) error {
+	e := &AuditEntry{
+		OccurredAt: dbTime(time.Now()),
+		Actor:      actor(ctx),
+		RequestID:  requestID(ctx),
+		Entity:     entity,
+		EntityID:   id,
+		Action:     action,
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+	}
+	if err := a.audit.RecordAudit(ctx, e); err != nil {
+		return fmt.Errorf("recording %s of %s %d in the audit log: %w", action, entity, id, err)
+	}
+	return nil
+}
+
+// auditJSON returns nil for nil records, including typed nil pointers.
+func auditJSON(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil
+	}
+	return data
+}
+
+func (a *auditedStore) CreateWorker(ctx context.Context, in *WorkerInput) (id int64, err error) {
+	err = a.tx.InTx(ctx, func(ctx context.Context) error {
+		if id, err = a.WorkerStore.CreateWorker(ctx, in); err != nil {
+			return err
+		}
+		after, _ := a.WorkerStore.GetWorker(ctx, int(id))
+		return a.record(ctx, auditWorker, int(id), "create", nil, after)
+	})
+	return id, err
+}
+
+func (a *auditedStore) UpdateWorker(ctx context.Context, id int, in *WorkerInput, rowVersion string) error {
+	return a.changeWorker(ctx, id, "update", func(ctx context.Context) error {
+		return a.WorkerStore.UpdateWorker(ctx, id, in, rowVersion)
+	})
+}
+
+func (a *auditedStore) PatchWorker(ctx context.Context, id int, columns map[string]interface{}, rowVersion string) error {
+	return a.changeWorker(ctx, id, "update", func(ctx context.Context) error {
+		return a.WorkerStore.PatchWorker(ctx, id, columns, rowVersion)
+	})
+}
+
+func (a *auditedStore) SetWorkerImage(ctx context.Context, id int, images map[string]*WorkerImage) error {
+	return a.changeWorker(ctx, id, "update", func(ctx context.Context) error {
+		return a.WorkerStore.SetWorkerImage(ctx, id, images)
+	})
+}
+
+func (a *auditedStore) DeleteWorker(ctx context.Context, id int, rowVersion string) error {
+	return a.tx.InTx(ctx, func(ctx context.Context) error {
+		before, _ := a.WorkerStore.GetWorker(ctx, id)
+		if err := a.WorkerStore.DeleteWorker(ctx, id, rowVersion); err != nil {
+			return err
+		}
+		return a.record(ctx, auditWorker, id, "delete", before, nil)
+	})
+}
+
+// RestoreWorker records nothing for a worker that was not archived, which
+// is the only kind that can be read.
+func (a *auditedStore) RestoreWorker(ctx context.Context, id int) error {
+	return a.tx.InTx(ctx, func(ctx context.Context) error {
+		if active, _ := a.WorkerStore.GetWorker(ctx, id); active != nil {
+			return a.WorkerStore.RestoreWorker(ctx, id)
+		}
+		if err := a.WorkerStore.RestoreWorker(ctx, id); err != nil {
+			return err
+		}
+		after, _ := a.WorkerStore.GetWorker(ctx, id)
+		return a.record(ctx, auditWorker, id, "restore", nil, after)
+	})
+}
+
+// PurgeWorkers records the removal of each purged worker with the record as
+// it was archived.
+func (a *auditedStore) PurgeWorkers(ctx context.Context, archivedBefore time.Time) (workers []MedicalWorker, err error) {
+	err = a.tx.InTx(ctx, func(ctx context.Context) error {
+		if workers, err = a.WorkerStore.PurgeWorkers(ctx, archivedBefore); err != nil {
+			return err
+		}
+		for i := range workers {
+			if err := a.record(ctx, auditWorker, workers[i].WorkerID, "purge", &workers[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return workers, err
+}
+
+// changeWorker makes a change and records it with the worker read before
+// and after it.
+func (a *auditedStore) changeWorker(ctx context.Context, id int, action string, change func(ctx context.Context) error) error {
+	return a.tx.InTx(ctx, func(ctx context.Context) error {
+		before, _ := a.WorkerStore.GetWorker(ctx, id)
+		if err := change(ctx); err != nil {
+			return err
+		}
+		after, _ := a.WorkerStore.GetWorker(ctx, id)
+		return a.record(ctx, auditWorker, id, action, before, after)
+	})
+}
+
+func (a *auditedStore) CreateDepartment(ctx context.Context, in *DepartmentInput) (id int64, err error) {
+	err = a.tx.InTx(ctx, func(ctx context.Context) error {
+		if id, err = a.DepartmentStore.CreateDepartment(ctx, in); err != nil {
+			return err
+		}
+		after, _ := a.DepartmentStore.GetDepartment(ctx, int(id))
+		return a.record(ctx, auditDepartment, int(id), "create", nil, after)
+	})
+	return id, err
+}
+
+func (a *auditedStore) UpdateDepartment(ctx context.Context, id int, in *DepartmentInput, rowVersion string) error {
+	return a.tx.InTx(ctx, func(ctx context.Context) error {
+		before, _ := a.DepartmentStore.GetDepartment(ctx, id)
+		if err := a.DepartmentStore.UpdateDepartment(ctx, id, in, rowVersion); err != nil {
+			return err
+		}
+		after, _ := a.DepartmentStore.GetDepartment(ctx, id)
+		return a.record(ctx, auditDepartment, id, "update", before, after)
+	})
+}
+
+// DeleteDepartment also records the move of each worker of the department
+// to the new one.
+func (a *auditedStore) DeleteDepartment(ctx context.Context, id, reassignTo int, dryRun bool) (workers []MedicalWorker, err error) {
+	if dryRun {
+		return a.DepartmentStore.DeleteDepartment(ctx, id, reassignTo, dryRun)
+	}
+	err = a.tx.InTx(ctx, func(ctx context.Context) error {
+		before, _ := a.DepartmentStore.GetDepartment(ctx, id)
+		if workers, err = a.DepartmentStore.DeleteDepartment(ctx, id, reassignTo, dryRun); err != nil {
+			return err
+		}
+		if err := a.record(ctx, auditDepartment, id, "delete", before, nil); err != nil {
+			return err
+		}
+		var target *Department
+		if reassignTo != 0 {
+			target, _ = a.DepartmentStore.GetDepartment(ctx, reassignTo)
+		}
+		for i := range workers {
+			mw := &workers[i]
+			moved := *mw
+			moved.DepartmentID = reassignTo
+			if target != nil {
+				moved.DepartmentName = target.DepartmentName
+			}
+			if err := a.record(ctx, auditWorker, mw.WorkerID, "update", mw, &moved); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return workers, err
+}
+
+func (a *auditedStore) CreateFacilityType(ctx context.Context, in *FacilityTypeInput) (id int64, err error) {
+	err = a.tx.InTx(ctx, func(ctx context.Context) error {
+		if id, err = a.ReferenceStore.CreateFacilityType(ctx, in); err != nil {
+			return err
+		}
+		after, _ := a.ReferenceStore.GetFacilityType(ctx, int(id))
+		return a.record(ctx, auditFacilityType, int(id), "create", nil, after)
+	})
+	return id, err
+}
+
+func (a *auditedStore) UpdateFacilityType(ctx context.Context, id int, in *FacilityTypeInput) error {
+	return a.tx.InTx(ctx, func(ctx context.Context) error {
+		before, _ := a.ReferenceStore.GetFacilityType(ctx, id)
+		if err := a.ReferenceStore.UpdateFacilityType(ctx, id, in); err != nil {
+			return err
+		}
+		after, _ := a.ReferenceStore.GetFacilityType(ctx, id)
+		return a.record(ctx, auditFacilityType, id, "update", before, after)
+	})
+}
+
+func (a *auditedStore) DeleteFacilityType(ctx context.Context, id int) (refs map[string]int, err error) {
+	err = a.tx.InTx(ctx, func(ctx context.Context) error {
+		before, _ := a.ReferenceStore.GetFacilityType(ctx, id)
+		if refs, err = a.ReferenceStore.DeleteFacilityType(ctx, id); err != nil {
+			return err
+		}
+		return a.record(ctx, auditFacilityType, id, "delete", before, nil)
+	})
+	return refs, err
+}
+
+func (a *auditedStore) CreateSpecialization(ctx context.Context, in *SpecializationInput) (id int64, err error) {
+	err = a.tx.InTx(ctx, func(ctx context.Context) error {
+		if id, err = a.ReferenceStore.CreateSpecialization(ctx, in); err != nil {
+			return err
+		}
+		after, _ := a.ReferenceStore.GetSpecialization(ctx, int(id))
+		return a.record(ctx, auditSpecialization, int(id), "create", nil, after)
+	})
+	return id, err
+}
+
+func (a *auditedStore) UpdateSpecialization(ctx context.Context, id int, in *SpecializationInput) error {
+	return a.tx.InTx(ctx, func(ctx context.Context) error {
+		before, _ := a.ReferenceStore.GetSpecialization(ctx, id)
+		if err := a.ReferenceStore.UpdateSpecialization(ctx, id, in); err != nil {
+			return err
+		}
+		after, _ := a.ReferenceStore.GetSpecialization(ctx, id)
+		return a.record(ctx, auditSpecialization, id, "update", before, after)
+	})
+}
+
+func (a *auditedStore) DeleteSpecialization(ctx context.Context, id int) (refs map[string]int, err error) {
+	err = a.tx.InTx(ctx, func(ctx context.Context) error {
+		before, _ := a.ReferenceStore.GetSpecialization(ctx, id)
+		if refs, err = a.ReferenceStore.DeleteSpecialization(ctx, id); err != nil {
+			return err
+		}
+		return a.record(ctx, auditSpecialization, id, "delete", before, nil)
+	})
+	return refs, err
+}
+
+func (s *server) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permViewAudit) {
+		return
+	}
+	filters, err := parseFilters(r.URL.Query(), auditFilters)
+	if err != nil {
+		writeError(w, r, invalidFilter(err))
+		return
+	}
+	entries, total, err := s.audit.ListAudit(r.Context(), filters)
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingAudit refuses to record anything.
+type failingAudit struct {
+	AuditStore
+}
+
+func (failingAudit) RecordAudit(ctx context.Context, e *AuditEntry) error {
+	return errors.New("audit_log is read-only")
+}
+
+func newTestAuditedStore(t *testing.T) (*auditedStore, *sqlStore) {
+	store := newTestStore(t)
+	return newAuditedStore(store, store, store, store, store), store
+}
+
+func auditEntries(t *testing.T, store *sqlStore, filters Filters) []AuditEntry {
+	t.Helper()
+	entries, _, err := store.ListAudit(context.Background(), filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestAuditedUpdateWorker(t *testing.T) {
+	audited, store := newTestAuditedStore(t)
+	ctx := withActor(context.Background(), "hr")
+	before, _ := store.GetWorker(ctx, 1)
+	in := before.input()
+	in.Salary = 123456
+	if err := audited.UpdateWorker(ctx, 1, &in, before.RowVersion); err != nil {
+		t.Fatal(err)
+	}
+	entries := auditEntries(t, store, Filters{"entity": auditWorker, "entity_id": 1})
+	if len(entries) != 1 {
+		t.Fatalf("%d entries, want 1", len(entries))
+	}
+	e := entries[0]
+	var old, updated MedicalWorker
+	json.Unmarshal(e.Before, &old)
+	json.Unmarshal(e.After, &updated)
+	if e.Action != "update" || e.Actor != "hr" || old.Salary != before.Salary || updated.Salary != 123456 {
+		t.Errorf("entry %s by %s from %v to %v", e.Action, e.Actor, old.Salary, updated.Salary)
+	}
+
+	// A failed change records nothing.
+	if err := audited.UpdateWorker(ctx, 1, &in, before.RowVersion); err != ErrConflict {
+		t.Fatalf("stale update: %v", err)
+	}
+	if n := len(auditEntries(t, store, Filters{"entity": auditWorker})); n != 1 {
+		t.Errorf("%d entries after a conflict, want 1", n)
+	}
+}
+
+func TestAuditedDeleteDepartmentRecordsMovedWorkers(t *testing.T) {
+	audited, store := newTestAuditedStore(t)
+	ctx := withActor(context.Background(), "hr")
+	workers, err := audited.DeleteDepartment(ctx, 1, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workers) != 2 {
+		t.Fatalf("%d workers moved, want 2", len(workers))
+	}
+	if n := len(auditEntries(t, store, Filters{"entity": auditDepartment, "entity_id": 1, "action": "delete"})); n != 1 {
+		t.Errorf("%d department entries, want 1", n)
+	}
+	for _, mw := range workers {
+		entries := auditEntries(t, store, Filters{"entity": auditWorker, "entity_id": mw.WorkerID})
+		if len(entries) != 1 {
+			t.Errorf("worker %d: %d entries, want 1", mw.WorkerID, len(entries))
+			continue
+		}
+		var old, moved MedicalWorker
+		json.Unmarshal(entries[0].Before, &old)
+		json.Unmarshal(entries[0].After, &moved)
+		if old.DepartmentID != 1 || moved.DepartmentID != 2 || moved.DepartmentName != "Neurology Department" {
+			t.Errorf("worker %d moved from %d to %d %q", mw.WorkerID, old.DepartmentID, moved.DepartmentID, moved.DepartmentName)
+		}
+	}
+
+	// A dry run records nothing.
+	if _, err := audited.DeleteDepartment(ctx, 3, 2, true); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(auditEntries(t, store, Filters{})); n != 3 {
+		t.Errorf("%d entries after a dry run, want 3", n)
+	}
+}
+
+func TestAuditedRestoreWorker(t *testing.T) {
+	audited, store := newTestAuditedStore(t)
+	ctx := context.Background()
+	if err := audited.RestoreWorker(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(auditEntries(t, store, Filters{})); n != 0 {
+		t.Fatalf("restoring an active worker recorded %d entries", n)
+	}
+	if err := audited.DeleteWorker(ctx, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := audited.RestoreWorker(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	entries := auditEntries(t, store, Filters{"entity_id": 1})
+	if len(entries) != 2 || entries[0].Action != "restore" || entries[1].Action != "delete" || entries[0].Actor != "anonymous" {
+		t.Errorf("entries %+v, want restore after delete", entries)
+	}
+}
+
+func TestAuditedPurgeWorkers(t *testing.T) {
+	audited, store := newTestAuditedStore(t)
+	ctx := withActor(context.Background(), retentionActor)
+	for _, id := range []int{3, 4} {
+		if err := store.DeleteWorker(ctx, id, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	purged, err := audited.PurgeWorkers(ctx, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(purged) != 2 {
+		t.Fatalf("purged %d workers, want 2", len(purged))
+	}
+	entries := auditEntries(t, store, Filters{"action": "purge"})
+	if len(entries) != 2 {
+		t.Fatalf("%d purge entries, want 2", len(entries))
+	}
+	for _, e := range entries {
+		var old MedicalWorker
+		json.Unmarshal(e.Before, &old)
+		if e.Actor != retentionActor || e.After != nil || old.WorkerID != e.EntityID || old.DeletedAt == nil {
+			t.Errorf("entry %+v", e)
+		}
+	}
+	if _, err := store.WorkerHistory(ctx, 3); err != nil {
+		t.Errorf("history of a purged worker: %v", err)
+	}
+}
+
+// TestAuditFailureRollsBack checks that a change is not made when its audit
+// entry cannot be written.
+func TestAuditFailureRollsBack(t *testing.T) {
+	store := newTestStore(t)
+	audited := newAuditedStore(store, store, store, failingAudit{store}, store)
+	ctx := context.Background()
+
+	before, _ := store.GetWorker(ctx, 1)
+	in := before.input()
+	in.Salary = 1
+	if err := audited.UpdateWorker(ctx, 1, &in, before.RowVersion); err == nil {
+		t.Fatal("update succeeded without its audit entry")
+	}
+	if after, _ := store.GetWorker(ctx, 1); after.Salary != before.Salary || after.RowVersion != before.RowVersion {
+		t.Errorf("update was kept: salary %v, row version %s", after.Salary, after.RowVersion)
+	}
+
+	if _, err := audited.DeleteDepartment(ctx, 1, 2, false); err == nil {
+		t.Fatal("department deleted without its audit entry")
+	}
+	if _, err := store.GetDepartment(ctx, 1); err != nil {
+		t.Errorf("department 1: %v", err)
+	}
+	if mw, _ := store.GetWorker(ctx, 1); mw.DepartmentID != 1 {
+		t.Errorf("worker 1 moved to department %d", mw.DepartmentID)
+	}
+
+	if err := store.DeleteWorker(ctx, 2, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := audited.PurgeWorkers(ctx, time.Now().Add(time.Second)); err == nil {
+		t.Fatal("purge succeeded without its audit entries")
+	}
+	if err := store.RestoreWorker(ctx, 2); err != nil {
+		t.Errorf("purged worker: %v", err)
+	}
+}
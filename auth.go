@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Browsers keep the session token in an HTTP-only cookie. The CSRF token of
+// the session is also sent in a cookie that scripts can read, and every
+// state-changing API request must echo it in the X-CSRF-Token header, which
+// another site cannot do.
+const (
+	sessionCookie = "medical_session"
+	csrfCookie    = "medical_csrf"
+	csrfHeader    = "X-CSRF-Token"
+)
+
+// publicPages are the static files served without a session.
+var publicPages = map[string]bool{
+	"/login.html": true,
+	"/login.js":   true,
+	"/auth.js":    true,
+	"/styles.css": true,
+}
+
+// dummyHash is compared against for unknown users, so that a login takes
+// as long for a missing user as for a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// checkPassword enforces the password length; bcrypt ignores bytes past 72.
+func checkPassword(password string) error {
+	if len(password) < 8 {
+		return fmt.Errorf("must be at least 8 characters")
+	}
+	if len(password) > 72 {
+		return fmt.Errorf("must be at most 72 bytes")
+	}
+	return nil
+}
+
+func hashPassword(password string) (string, error) {
+	if err := checkPassword(password); err != nil {
+		return "", fmt.Errorf("password %w", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// randomToken returns 32 random bytes in hex.
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tokenHash returns the hex SHA-256 of a session or API token, which is
+// stored instead of the token itself.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func withSession(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, sessionKey, sess)
+}
+
+func currentSession(ctx context.Context) *Session {
+	sess, _ := ctx.Value(sessionKey).(*Session)
+	return sess
+}
+
+// session returns the session of the request's API token or cookie,
+// ErrNotFound when there is none or it has expired.
+func (s *server) session(r *http.Request) (*Session, error) {
+	if token, ok := bearerToken(r); ok {
+		if !strings.HasPrefix(token, tokenPrefix) {
+			return nil, ErrNotFound
+		}
+		return s.tokens.TokenSession(r.Context(), tokenHash(token), time.Now())
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil || c.Value == "" {
+		return nil, ErrNotFound
+	}
+	return s.users.GetSession(r.Context(), tokenHash(c.Value), time.Now())
+}
+
+// requireSession rejects API requests without a valid session with 401 and
+// state-changing ones without the CSRF token with 403. API token requests
+// need no CSRF token, as browsers do not send them on their own, but a scope
+// covering the request. The user becomes the actor of the audit log.
+func (s *server) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, err := s.session(r)
+		if _, bearer := bearerToken(r); bearer && err == ErrNotFound {
+			writeError(w, r, unauthorized("Invalid, expired or revoked API token"))
+			return
+		}
+		if err == ErrNotFound {
+			writeError(w, r, unauthorized("Login required"))
+			return
+		}
+		if err != nil {
+			writeError(w, r, internalError("Database error", err))
+			return
+		}
+		actor := sess.Username
+		if sess.TokenID != 0 {
+			if scope := sess.missingScope(r); scope != "" {
+				writeError(w, r, insufficientScope(scope))
+				return
+			}
+			actor = fmt.Sprintf("%s (token %d)", sess.Username, sess.TokenID)
+		} else {
+			switch r.Method {
+			case "GET", "HEAD", "OPTIONS":
+			default:
+				token := r.Header.Get(csrfHeader)
+				if subtle.ConstantTimeCompare([]byte(token), []byte(sess.CSRFToken)) != 1 {
+					writeError(w, r, invalidCSRFToken())
+					return
+				}
+			}
+		}
+		ctx := withActor(withSession(r.Context(), sess), actor)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// pageHandler serves the web UI, redirecting to the login page when there
+// is no session.
+func (s *server) pageHandler(files http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !publicPages[r.URL.Path] {
+			if _, err := s.session(r); err != nil {
+				if err != ErrNotFound {
+					log.Printf("Error reading session: %v", err)
+				}
+				http.Redirect(w, r, "/login.html?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) setSessionCookies(w http.ResponseWriter, token, csrfToken string, expires time.Time) {
+	maxAge := int(time.Until(expires).Seconds())
+	if token == "" {
+		maxAge = -1
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: sessionCookie, Value: token, Path: "/", MaxAge: maxAge,
+		HttpOnly: true, Secure: s.auth.SecureCookies, SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name: csrfCookie, Value: csrfToken, Path: "/", MaxAge: maxAge,
+		Secure: s.auth.SecureCookies, SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *server) login(w http.ResponseWriter, r *http.Request) {
+	// Only JSON is accepted, so that a form on another site cannot log the
+	// browser in to an account of the attacker.
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		writeError(w, r, unsupportedMediaType("Send the credentials as application/json"))
+		return
+	}
+	var creds struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		writeError(w, r, badRequest("Invalid JSON"))
+		return
+	}
+	user, err := s.users.GetUserByName(r.Context(), strings.TrimSpace(creds.Username))
+	if err != nil && err != ErrNotFound {
+		writeError(w, r, internalError("Database error", err))
+		return
+	}
+	hash := dummyHash
+	if user != nil {
+		hash = []byte(user.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(creds.Password)) != nil || user == nil {
+		log.Printf("[%s] Failed login for %q", requestID(r.Context()), creds.Username)
+		writeError(w, r, unauthorized("Invalid username or password"))
+		return
+	}
+	token := randomToken()
+	expires := time.Now().Add(s.auth.SessionTTL)
+	sess := &Session{
+		ID:        tokenHash(token),
+		UserID:    user.UserID,
+		Username:  user.Username,
+		CSRFToken: randomToken(),
+		ExpiresAt: dbTime(expires),
+	}
+	err = s.users.CreateSession(r.Context(), sess)
+	if err == nil {
+		// Read back with the user's departments.
+		sess, err = s.users.GetSession(r.Context(), sess.ID, time.Now())
+	}
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
+	}
+	s.setSessionCookies(w, token, sess.CSRFToken, expires)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionInfo(sess))
+}
+
+func (s *server) logout(w http.ResponseWriter, r *http.Request) {
+	if err := s.users.DeleteSession(r.Context(), currentSession(r.Context()).ID); err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
+	}
+	s.setSessionCookies(w, "", "", time.Time{})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+}
+
+func (s *server) getSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessionInfo(currentSession(r.Context())))
+}
+
+// sessionInfo tells the web UI who is logged in and what they may do.
+func sessionInfo(sess *Session) map[string]interface{} {
+	info := map[string]interface{}{
+		"username":       sess.Username,
+		"role":           sess.Role,
+		"department_ids": sess.DepartmentIDs,
+		"permissions":    append([]permission{}, rolePermissions[sess.Role]...),
+		"csrf_token":     sess.CSRFToken,
+	}
+	if sess.TokenID != 0 {
+		info["token_id"] = sess.TokenID
+		info["scopes"] = sess.Scopes
+	}
+	return info
+}
+
+// createInitialAdmin adds the HR user "admin" with the configured password when
+// there are no users yet, so that a fresh database can be logged in to.
+func createInitialAdmin(ctx context.Context, users UserStore, password string) error {
+	n, err := users.CountUsers(ctx)
+	if err != nil || n > 0 {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := users.CreateUser(ctx, "admin", hash, roleHR, nil); err != nil {
+		return err
+	}
+	fmt.Println("Created user admin")
+	return nil
+}
+
+const usersUsage = "usage: users add <username> <role> [department_id...] | role <username> <role> [department_id...] | passwd <username>"
+
+// usersCommand manages users from the command line. Passwords are read from
+// the first line of standard input.
+func usersCommand(ctx context.Context, users UserStore, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf(usersUsage)
+	}
+	username := strings.TrimSpace(args[1])
+	if username == "" || len(username) > 50 {
+		return fmt.Errorf("username must be 1 to 50 characters")
+	}
+	switch args[0] {
+	case "add":
+		role, departments, err := parseRole(args[2:])
+		if err != nil {
+			return err
+		}
+		hash, err := readPassword(username)
+		if err != nil {
+			return err
+		}
+		_, err = users.CreateUser(ctx, username, hash, role, departments)
+		switch err {
+		case nil:
+			fmt.Println("created user", username)
+		case ErrDuplicate:
+			err = fmt.Errorf("user %s already exists", username)
+		case ErrInvalidReference:
+			err = fmt.Errorf("a department does not exist")
+		}
+		return err
+	case "role":
+		role, departments, err := parseRole(args[2:])
+		if err != nil {
+			return err
+		}
+		err = users.SetRole(ctx, username, role, departments)
+		switch err {
+		case nil:
+			fmt.Printf("%s is now %s\n", username, role)
+		case ErrNotFound:
+			err = fmt.Errorf("user %s does not exist", username)
+		case ErrInvalidReference:
+			err = fmt.Errorf("a department does not exist")
+		}
+		return err
+	case "passwd":
+		if len(args) != 2 {
+			return fmt.Errorf(usersUsage)
+		}
+		hash, err := readPassword(username)
+		if err != nil {
+			return err
+		}
+		err = users.SetPassword(ctx, username, hash)
+		switch err {
+		case nil:
+			fmt.Println("changed the password of", username)
+		case ErrNotFound:
+			err = fmt.Errorf("user %s does not exist", username)
+		}
+		return err
+	}
+	return fmt.Errorf(usersUsage)
+}
+
+// parseRole reads a role and, for department heads, their departments.
+func parseRole(args []string) (string, []int, error) {
+	if len(args) == 0 || !validRole(args[0]) {
+		return "", nil, fmt.Errorf("role must be one of %s", strings.Join(roles, ", "))
+	}
+	role := args[0]
+	var departments []int
+	for _, arg := range args[1:] {
+		id, err := parseID(arg)
+		if err != nil {
+			return "", nil, fmt.Errorf("department id %q %v", arg, err)
+		}
+		departments = append(departments, id.(int))
+	}
+	if role == roleDepartmentHead && len(departments) == 0 {
+		return "", nil, fmt.Errorf("a department head needs at least one department id")
+	}
+	if role != roleDepartmentHead && len(departments) > 0 {
+		return "", nil, fmt.Errorf("only department heads have departments")
+	}
+	return role, departments, nil
+}
+
+func readPassword(username string) (string, error) {
+	fmt.Fprintf(os.Stderr, "Password for %s: ", username)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	return hashPassword(strings.TrimRight(line, "\r\n"))
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "password123"
+
+// testServer serves the API and pages of a server on a test database with
+// a user of each role: "hr", "head" of Cardiology (department 1) and
+// "reception".
+type testServer struct {
+	*httptest.Server
+	store *sqlStore
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store := newTestStore(t)
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, u := range []struct {
+		name, role  string
+		departments []int
+	}{
+		{"hr", roleHR, nil},
+		{"head", roleDepartmentHead, []int{1}},
+		{"reception", roleReceptionist, nil},
+	} {
+		if _, err := store.CreateUser(ctx, u.name, string(hash), u.role, u.departments); err != nil {
+			t.Fatal(err)
+		}
+	}
+	static := t.TempDir()
+	for _, page := range []string{"index.html", "view.html", "login.html"} {
+		if err := os.WriteFile(filepath.Join(static, page), []byte(page), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	audited := newAuditedStore(store, store, store, store, store)
+	srv := &server{
+		workers:     audited,
+		departments: audited,
+		refs:        audited,
+		reports:     store,
+		audit:       store,
+		users:       store,
+		tokens:      store,
+		blobs:       &fsBlobStore{dir: t.TempDir()},
+		auth:        AuthConfig{SessionTTL: time.Hour},
+	}
+	ts := &testServer{Server: httptest.NewServer(srv.routes(static)), store: store}
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// testClient is a browser of the test server: it keeps cookies, does not
+// follow redirects and sends its CSRF token and API token, if any.
+type testClient struct {
+	t     *testing.T
+	base  string
+	http  *http.Client
+	csrf  string
+	token string
+}
+
+func (ts *testServer) client(t *testing.T) *testClient {
+	jar, _ := cookiejar.New(nil)
+	return &testClient{t: t, base: ts.URL, http: &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+}
+
+// login returns a client logged in as username.
+func (ts *testServer) login(t *testing.T, username string) *testClient {
+	t.Helper()
+	c := ts.client(t)
+	status, body := c.do("POST", "/api/login", `{"username":"`+username+`","password":"`+testPassword+`"}`)
+	if status != http.StatusOK {
+		t.Fatalf("login as %s: %d %s", username, status, body)
+	}
+	var info struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		t.Fatal(err)
+	}
+	c.csrf = info.CSRFToken
+	return c
+}
+
+func (c *testClient) do(method, path, body string) (int, []byte) {
+	c.t.Helper()
+	resp := c.send(method, path, body)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+func (c *testClient) send(method, path, body string) *http.Response {
+	c.t.Helper()
+	r, err := http.NewRequest(method, c.base+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if c.csrf != "" {
+		r.Header.Set(csrfHeader, c.csrf)
+	}
+	if c.token != "" {
+		r.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+// errorCode returns the code of an API error response.
+func errorCode(body []byte) string {
+	var resp APIError
+	json.Unmarshal(body, &resp)
+	return resp.Code
+}
+
+func TestLogin(t *testing.T) {
+	ts := newTestServer(t)
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"wrong password", `{"username":"hr","password":"password124"}`, http.StatusUnauthorized},
+		{"unknown user", `{"username":"nobody","password":"password123"}`, http.StatusUnauthorized},
+		{"empty", `{}`, http.StatusUnauthorized},
+		{"invalid JSON", `{"username":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		c := ts.client(t)
+		status, body := c.do("POST", "/api/login", tt.body)
+		if status != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.name, status, body, tt.status)
+		}
+		u, _ := url.Parse(ts.URL)
+		if cookies := c.http.Jar.Cookies(u); len(cookies) != 0 {
+			t.Errorf("%s: got cookies %v", tt.name, cookies)
+		}
+		if status, _ := c.do("GET", "/api/session", ""); status != http.StatusUnauthorized {
+			t.Errorf("%s: session request got %d", tt.name, status)
+		}
+	}
+
+	// A form post from another site must not log the browser in.
+	c := ts.client(t)
+	resp, err := c.http.PostForm(ts.URL+"/api/login", url.Values{"username": {"hr"}, "password": {testPassword}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("form login got %d, want 415", resp.StatusCode)
+	}
+
+	c = ts.client(t)
+	resp = c.send("POST", "/api/login", `{"username":" head ","password":"`+testPassword+`"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("login got %d", resp.StatusCode)
+	}
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	if sc := cookies[sessionCookie]; sc == nil || sc.Value == "" || !sc.HttpOnly {
+		t.Errorf("session cookie %v, want a value and HttpOnly", sc)
+	}
+	if cc := cookies[csrfCookie]; cc == nil || cc.Value == "" || cc.HttpOnly {
+		t.Errorf("CSRF cookie %v, want a value readable by scripts", cc)
+	}
+	status, body := c.do("GET", "/api/session", "")
+	var info struct {
+		Username      string `json:"username"`
+		Role          string `json:"role"`
+		DepartmentIDs []int  `json:"department_ids"`
+		CSRFToken     string `json:"csrf_token"`
+	}
+	json.Unmarshal(body, &info)
+	if status != http.StatusOK || info.Username != "head" || info.Role != roleDepartmentHead ||
+		len(info.DepartmentIDs) != 1 || info.DepartmentIDs[0] != 1 || info.CSRFToken != cookies[csrfCookie].Value {
+		t.Errorf("session %d %s", status, body)
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	ts := newTestServer(t)
+	anonymous := ts.client(t)
+	for _, path := range []string{"/api/session", "/api/medical-workers", "/api/medical-workers/1", "/api/download-report", "/api/nothing"} {
+		if status, body := anonymous.do("GET", path, ""); status != http.StatusUnauthorized || errorCode(body) != "UNAUTHORIZED" {
+			t.Errorf("GET %s without a session: %d %s", path, status, body)
+		}
+	}
+	if status, _ := anonymous.do("DELETE", "/api/medical-workers/1", ""); status != http.StatusUnauthorized {
+		t.Errorf("DELETE without a session: %d", status)
+	}
+
+	forged := ts.client(t)
+	u, _ := url.Parse(ts.URL)
+	forged.http.Jar.SetCookies(u, []*http.Cookie{{Name: sessionCookie, Value: randomToken()}})
+	if status, _ := forged.do("GET", "/api/session", ""); status != http.StatusUnauthorized {
+		t.Errorf("unknown session cookie: %d", status)
+	}
+
+	hr := ts.login(t, "hr")
+	if status, body := hr.do("GET", "/api/nothing", ""); status != http.StatusNotFound {
+		t.Errorf("unknown endpoint with a session: %d %s", status, body)
+	}
+	for _, csrf := range []string{"", "wrong", strings.ToUpper(hr.csrf)} {
+		c := *hr
+		c.csrf = csrf
+		// Reading needs no CSRF token.
+		if status, _ := c.do("GET", "/api/medical-workers/1", ""); status != http.StatusOK {
+			t.Errorf("GET with CSRF token %q: %d", csrf, status)
+		}
+		for _, req := range []struct{ method, path, body string }{
+			{"DELETE", "/api/medical-workers/1", ""},
+			{"POST", "/api/medical-workers/2/restore", ""},
+			{"PATCH", "/api/medical-workers/1", `{"salary": 1}`},
+			{"POST", "/api/departments", `{"department_name":"X","facility_type_id":1}`},
+			{"POST", "/api/logout", ""},
+		} {
+			status, body := c.do(req.method, req.path, req.body)
+			if status != http.StatusForbidden || errorCode(body) != "CSRF_TOKEN_INVALID" {
+				t.Errorf("%s %s with CSRF token %q: %d %s", req.method, req.path, csrf, status, body)
+			}
+		}
+	}
+	if status, body := hr.do("GET", "/api/medical-workers/1", ""); status != http.StatusOK || !strings.Contains(string(body), `"salary":`) {
+		t.Errorf("worker 1 changed by rejected requests: %d %s", status, body)
+	}
+	if status, body := hr.do("DELETE", "/api/medical-workers/1", ""); status != http.StatusOK {
+		t.Errorf("DELETE with the CSRF token: %d %s", status, body)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	ts := newTestServer(t)
+	c := ts.login(t, "hr")
+	other := ts.login(t, "hr")
+	u, _ := url.Parse(ts.URL)
+	cookies := c.http.Jar.Cookies(u)
+
+	if status, body := c.do("POST", "/api/logout", ""); status != http.StatusOK {
+		t.Fatalf("logout: %d %s", status, body)
+	}
+	if left := c.http.Jar.Cookies(u); len(left) != 0 {
+		t.Errorf("cookies left after logout: %v", left)
+	}
+	// The old cookie no longer works, even if a copy of it was kept.
+	c.http.Jar.SetCookies(u, cookies)
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/api/session"},
+		{"GET", "/api/medical-workers"},
+		{"POST", "/api/logout"},
+	} {
+		if status, _ := c.do(req.method, req.path, ""); status != http.StatusUnauthorized {
+			t.Errorf("%s %s after logout: %d", req.method, req.path, status)
+		}
+	}
+	if status, _ := other.do("GET", "/api/session", ""); status != http.StatusOK {
+		t.Errorf("another session of the user got %d after logout", status)
+	}
+}
+
+func TestPageHandler(t *testing.T) {
+	ts := newTestServer(t)
+	anonymous := ts.client(t)
+	tests := []struct {
+		path     string
+		location string
+	}{
+		{"/", "/login.html?next=%2F"},
+		{"/view.html", "/login.html?next=%2Fview.html"},
+		{"/view.html?department_id=1", "/login.html?next=%2Fview.html%3Fdepartment_id%3D1"},
+		{"/missing.html", "/login.html?next=%2Fmissing.html"},
+	}
+	for _, tt := range tests {
+		resp := anonymous.send("GET", tt.path, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != tt.location {
+			t.Errorf("%s without a session: %d to %q, want a redirect to %q",
+				tt.path, resp.StatusCode, resp.Header.Get("Location"), tt.location)
+		}
+	}
+	if status, body := anonymous.do("GET", "/login.html", ""); status != http.StatusOK || string(body) != "login.html" {
+		t.Errorf("login page without a session: %d %s", status, body)
+	}
+
+	c := ts.login(t, "reception")
+	if status, body := c.do("GET", "/view.html", ""); status != http.StatusOK || string(body) != "view.html" {
+		t.Errorf("page with a session: %d %s", status, body)
+	}
+	if status, _ := c.do("GET", "/missing.html", ""); status != http.StatusNotFound {
+		t.Errorf("missing page with a session: %d", status)
+	}
+}
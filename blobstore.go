@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BlobStore keeps worker images outside the database. Keys are the SHA-256
+// of the content, so storing the same bytes twice is harmless and the blob of
+// a key never changes.
+type BlobStore interface {
+	// Put stores data under key; storing an existing blob again marks it as
+	// recently used.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns ErrNotFound for a missing blob.
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// List calls fn with every blob and the time it was last stored.
+	List(ctx context.Context, fn func(key string, stored time.Time) error) error
+}
+
+func blobKey(data []byte) string {
+	return sha256Hex(data)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func validBlobKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func openBlobStore(cfg BlobConfig) (BlobStore, error) {
+	switch cfg.Driver {
+	case "filesystem":
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, err
+		}
+		return &fsBlobStore{dir: cfg.Dir}, nil
+	case "s3":
+		return newS3BlobStore(cfg.S3), nil
+	}
+	return nil, fmt.Errorf("unknown blob store driver %q", cfg.Driver)
+}
+
+// fsBlobStore keeps blobs in files named by their key, in subdirectories by
+// the first two characters of the key.
+type fsBlobStore struct {
+	dir string
+}
+
+func (f *fsBlobStore) path(key string) (string, error) {
+	if !validBlobKey(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(f.dir, key[:2], key), nil
+}
+
+// Put writes a temporary file and renames it, so that a blob is never seen
+// half written.
+func (f *fsBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *fsBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (f *fsBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *fsBlobStore) List(ctx context.Context, fn func(key string, stored time.Time) error) error {
+	return filepath.WalkDir(f.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !validBlobKey(d.Name()) {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(d.Name(), info.ModTime())
+	})
+}
+
+// blobGracePeriod protects new blobs from collection while the upload that
+// stored them has not yet saved their keys in the database.
+const blobGracePeriod = time.Hour
+
+// collectBlobs deletes the blobs no worker image refers to any more: those of
+// replaced and removed images and of workers removed for good. It returns how
+// many were deleted.
+func collectBlobs(ctx context.Context, images ImageStore, blobs BlobStore, now time.Time) (int, error) {
+	used, err := images.ImageKeys(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var unused []string
+	err = blobs.List(ctx, func(key string, stored time.Time) error {
+		if !used[key] && stored.Before(now.Add(-blobGracePeriod)) {
+			unused = append(unused, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, key := range unused {
+		if err := blobs.Delete(ctx, key); err != nil {
+			return i, err
+		}
+	}
+	return len(unused), nil
+}
+
+// collectBlobsPeriodically runs until ctx is done.
+func collectBlobsPeriodically(ctx context.Context, images ImageStore, blobs BlobStore) {
+	ticker := time.NewTicker(blobGracePeriod)
+	defer ticker.Stop()
+	for {
+		n, err := collectBlobs(ctx, images, blobs, time.Now())
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error deleting unused images: %v", err)
+		} else if n > 0 {
+			log.Printf("Deleted %d unused images", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// moveImages copies the images still kept in the database to blob storage.
+func moveImages(ctx context.Context, images ImageStore, blobs BlobStore) (int, error) {
+	return images.MoveImages(ctx, func(img *WorkerImage) (string, error) {
+		if img.ContentType == "" {
+			img.ContentType = http.DetectContentType(img.Data)
+		}
+		key := blobKey(img.Data)
+		return key, blobs.Put(ctx, key, img.Data, img.ContentType)
+	})
+}
+
+const imagesUsage = "usage: images migrate | gc"
+
+// imagesCommand moves images out of the database ("migrate") and deletes the
+// unused blobs ("gc").
+func imagesCommand(ctx context.Context, images ImageStore, blobs BlobStore, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf(imagesUsage)
+	}
+	switch args[0] {
+	case "migrate":
+		n, err := moveImages(ctx, images, blobs)
+		fmt.Printf("moved %d images to blob storage\n", n)
+		return err
+	case "gc":
+		n, err := collectBlobs(ctx, images, blobs, time.Now())
+		fmt.Printf("deleted %d unused blobs\n", n)
+		return err
+	}
+	return fmt.Errorf(imagesUsage)
+}
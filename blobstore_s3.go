@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// s3BlobStore keeps blobs in a bucket of Amazon S3 or a compatible service
+// such as MinIO, addressed by path (endpoint/bucket/key). Requests are signed
+// with AWS Signature Version 4.
+type s3BlobStore struct {
+	cfg    S3Config
+	client *http.Client
+}
+
+func newS3BlobStore(cfg S3Config) *s3BlobStore {
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	return &s3BlobStore{cfg: cfg, client: &http.Client{Timeout: time.Minute}}
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !validBlobKey(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	resp, err := s.do(ctx, "PUT", s.cfg.Prefix+key, nil, data, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validBlobKey(key) {
+		return nil, fmt.Errorf("invalid blob key %q", key)
+	}
+	resp, err := s.do(ctx, "GET", s.cfg.Prefix+key, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (s *s3BlobStore) Delete(ctx context.Context, key string) error {
+	if !validBlobKey(key) {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	resp, err := s.do(ctx, "DELETE", s.cfg.Prefix+key, nil, nil, "")
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listBucketResult is the part of a ListObjectsV2 response used here.
+type listBucketResult struct {
+	Contents []struct {
+		Key          string
+		LastModified time.Time
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *s3BlobStore) List(ctx context.Context, fn func(key string, stored time.Time) error) error {
+	query := url.Values{"list-type": {"2"}, "prefix": {s.cfg.Prefix}}
+	for {
+		resp, err := s.do(ctx, "GET", "", query, nil, "")
+		if err != nil {
+			return err
+		}
+		var page listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("reading bucket listing: %w", err)
+		}
+		for _, obj := range page.Contents {
+			key := strings.TrimPrefix(obj.Key, s.cfg.Prefix)
+			if !validBlobKey(key) {
+				continue
+			}
+			if err := fn(key, obj.LastModified); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated {
+			return nil
+		}
+		query.Set("continuation-token", page.NextContinuationToken)
+	}
+}
+
+// do sends a signed request for an object, or for the bucket when key is
+// empty. A 404 becomes ErrNotFound and other failures an error with the
+// message of the service; the caller closes the body of a response.
+func (s *s3BlobStore) do(ctx context.Context, method, key string, query url.Values, body []byte, contentType string) (*http.Response, error) {
+	path := "/" + s.cfg.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+	// Escaping "+" as well makes the query canonical for the signature.
+	rawQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+	endpoint := s.cfg.Endpoint + path
+	if rawQuery != "" {
+		endpoint += "?" + rawQuery
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, path, rawQuery, body, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && key != "" {
+		return nil, ErrNotFound
+	}
+	var apiErr struct {
+		Code    string
+		Message string
+	}
+	xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&apiErr)
+	return nil, fmt.Errorf("s3 %s %s: %s %s %s", method, path, resp.Status, apiErr.Code, apiErr.Message)
+}
+
+// sign adds the Authorization header of Signature Version 4 with the payload
+// hash, date and content type among the signed headers.
+func (s *s3BlobStore) sign(req *http.Request, path, rawQuery string, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method, (&url.URL{Path: path}).EscapedPath(), rawQuery,
+		canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	signingKey := []byte("AWS4" + s.cfg.SecretKey)
+	for _, part := range []string{now.Format("20060102"), s.cfg.Region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(signingKey, stringToSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 serves a single bucket from memory, returning at most pageSize
+// objects per listing so that continuation tokens are exercised.
+type fakeS3 struct {
+	bucket   string
+	pageSize int
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	stored   map[string]time.Time
+	listings int
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{bucket: bucket, pageSize: 2, objects: map[string][]byte{}, stored: map[string]time.Time{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=") ||
+		r.Header.Get("X-Amz-Content-Sha256") == "" || r.Header.Get("X-Amz-Date") == "" {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case key == "" && r.Method == "GET":
+		f.list(w, r)
+	case r.Method == "PUT":
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		f.objects[key] = buf.Bytes()
+		f.stored[key] = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	case r.Method == "GET":
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == "DELETE":
+		if _, ok := f.objects[key]; !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("list-type") != "2" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.listings++
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, q.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	start := 0
+	if token := q.Get("continuation-token"); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+	end := min(start+f.pageSize, len(keys))
+	type object struct {
+		Key          string
+		LastModified string
+	}
+	page := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+	}{IsTruncated: end < len(keys)}
+	for _, key := range keys[start:end] {
+		page.Contents = append(page.Contents, object{key, f.stored[key].Format("2006-01-02T15:04:05.000Z")})
+	}
+	if page.IsTruncated {
+		page.NextContinuationToken = strconv.Itoa(end)
+	}
+	xml.NewEncoder(w).Encode(page)
+}
+
+func testS3Store(url string) *s3BlobStore {
+	return newS3BlobStore(S3Config{
+		Endpoint:  url + "/",
+		Region:    "us-east-1",
+		Bucket:    "images",
+		Prefix:    "workers/",
+		AccessKey: "key",
+		SecretKey: "secret",
+	})
+}
+
+func TestS3BlobStore(t *testing.T) {
+	fake, srv := newFakeS3(t, "images")
+	store := testS3Store(srv.URL)
+	ctx := context.Background()
+
+	data := []byte("photo")
+	key := blobKey(data)
+	if err := store.Put(ctx, key, data, "image/jpeg"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, ok := fake.objects["workers/"+key]; !ok {
+		t.Fatalf("object not stored under the prefix, have %v", fake.objects)
+	}
+	got, err := store.Get(ctx, key)
+	if err != nil || string(got) != "photo" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); err != ErrNotFound {
+		t.Fatalf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete of a missing blob: %v", err)
+	}
+	if err := store.Put(ctx, "../etc/passwd", data, ""); err == nil {
+		t.Fatal("Put accepted an invalid key")
+	}
+}
+
+func TestS3BlobStoreList(t *testing.T) {
+	fake, srv := newFakeS3(t, "images")
+	store := testS3Store(srv.URL)
+	ctx := context.Background()
+
+	want := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		data := []byte{byte(i)}
+		want[blobKey(data)] = true
+		if err := store.Put(ctx, blobKey(data), data, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Objects outside the prefix or not named by a key are skipped.
+	fake.objects["other/"+blobKey([]byte("x"))] = nil
+	fake.objects["workers/readme.txt"] = nil
+
+	got := map[string]bool{}
+	err := store.List(ctx, func(key string, stored time.Time) error {
+		if got[key] {
+			t.Errorf("key %s listed twice", key)
+		}
+		got[key] = true
+		if !stored.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+			t.Errorf("stored = %v", stored)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("listed %d keys, want %d", len(got), len(want))
+	}
+	for key := range want {
+		if !got[key] {
+			t.Errorf("key %s not listed", key)
+		}
+	}
+	if fake.listings != 3 {
+		t.Errorf("listed in %d requests, want 3 pages", fake.listings)
+	}
+}
+
+func TestS3BlobStoreErrors(t *testing.T) {
+	_, srv := newFakeS3(t, "images")
+	store := testS3Store(srv.URL)
+	store.cfg.Bucket = "missing"
+	ctx := context.Background()
+
+	// A missing bucket is an error, not an empty listing.
+	err := store.List(ctx, func(string, time.Time) error { return nil })
+	if err == nil || err == ErrNotFound || !strings.Contains(err.Error(), "NoSuchBucket") {
+		t.Fatalf("List of a missing bucket: %v", err)
+	}
+}
+
+// fakeImageStore reports a fixed set of keys as used.
+type fakeImageStore struct {
+	keys map[string]bool
+}
+
+func (f fakeImageStore) MoveImages(ctx context.Context, put func(img *WorkerImage) (string, error)) (int, error) {
+	return 0, nil
+}
+
+func (f fakeImageStore) ImageKeys(ctx context.Context) (map[string]bool, error) {
+	return f.keys, nil
+}
+
+func TestCollectBlobs(t *testing.T) {
+	dir := t.TempDir()
+	blobs := &fsBlobStore{dir: dir}
+	ctx := context.Background()
+	now := time.Now()
+
+	put := func(name string, age time.Duration) string {
+		t.Helper()
+		data := []byte(name)
+		key := blobKey(data)
+		if err := blobs.Put(ctx, key, data, ""); err != nil {
+			t.Fatal(err)
+		}
+		path, _ := blobs.path(key)
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	oldUnused := put("old unused", 2*time.Hour)
+	oldUsed := put("old used", 2*time.Hour)
+	newUnused := put("new unused", 10*time.Minute)
+	graceEdge := put("grace edge", blobGracePeriod-time.Minute)
+	// Files that are not blobs are left alone.
+	stray := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(stray, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(stray, now.Add(-48*time.Hour), now.Add(-48*time.Hour))
+
+	images := fakeImageStore{keys: map[string]bool{oldUsed: true}}
+	n, err := collectBlobs(ctx, images, blobs, now)
+	if err != nil {
+		t.Fatalf("collectBlobs: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("deleted %d blobs, want 1", n)
+	}
+	for key, kept := range map[string]bool{oldUnused: false, oldUsed: true, newUnused: true, graceEdge: true} {
+		_, err := blobs.Get(ctx, key)
+		if kept && err != nil {
+			t.Errorf("blob %s: %v, want it kept", key[:8], err)
+		}
+		if !kept && err != ErrNotFound {
+			t.Errorf("blob %s: %v, want it deleted", key[:8], err)
+		}
+	}
+	if _, err := os.Stat(stray); err != nil {
+		t.Errorf("stray file: %v", err)
+	}
+}
+
+func TestFSBlobStorePutRefreshes(t *testing.T) {
+	blobs := &fsBlobStore{dir: t.TempDir()}
+	ctx := context.Background()
+	data := []byte("photo")
+	key := blobKey(data)
+	if err := blobs.Put(ctx, key, data, ""); err != nil {
+		t.Fatal(err)
+	}
+	path, _ := blobs.path(key)
+	old := time.Now().Add(-2 * blobGracePeriod)
+	os.Chtimes(path, old, old)
+
+	// Storing the same image again must save its blob from collection.
+	if err := blobs.Put(ctx, key, data, ""); err != nil {
+		t.Fatal(err)
+	}
+	n, err := collectBlobs(ctx, fakeImageStore{}, blobs, time.Now())
+	if err != nil || n != 0 {
+		t.Fatalf("collectBlobs = %d, %v, want the blob kept", n, err)
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Listen    string         `yaml:"listen"`
+	StaticDir string         `yaml:"static_dir"`
+	Database  DatabaseConfig `yaml:"database"`
+	Upload    UploadConfig   `yaml:"upload"`
+	CORS      CORSConfig     `yaml:"cors"`
+	Archive   ArchiveConfig  `yaml:"archive"`
+	Auth      AuthConfig     `yaml:"auth"`
+	Blobs     BlobConfig     `yaml:"blobs"`
+}
+
+type DatabaseConfig struct {
+	// Driver is "mssql" or "sqlite". For SQLite the DSN is a file path or
+	// ":memory:".
+	Driver          string        `yaml:"driver"`
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// AutoMigrate applies pending migrations at startup instead of refusing
+	// to serve.
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+type UploadConfig struct {
+	MaxImageBytes int64 `yaml:"max_image_bytes"`
+	// MaxImageWidth and MaxImageHeight limit the pixel size of images.
+	MaxImageWidth  int `yaml:"max_image_width"`
+	MaxImageHeight int `yaml:"max_image_height"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// ArchiveConfig controls how long deleted workers are kept before they are
+// removed for good. A zero Retention keeps them forever.
+type ArchiveConfig struct {
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// BlobConfig selects where worker images are stored: Driver "filesystem"
+// keeps them under Dir, "s3" in a bucket of S3 or a compatible service.
+type BlobConfig struct {
+	Driver string   `yaml:"driver"`
+	Dir    string   `yaml:"dir"`
+	S3     S3Config `yaml:"s3"`
+}
+
+// S3Config addresses a bucket by path, endpoint/bucket/key, which every
+// S3-compatible service supports. Prefix is prepended to the keys.
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+// AuthConfig controls login sessions. SecureCookies must be turned off to
+// log in over plain HTTP from anywhere but localhost. InitialAdminPassword
+// creates the user "admin" when there are no users yet.
+type AuthConfig struct {
+	SessionTTL           time.Duration `yaml:"session_ttl"`
+	SecureCookies        bool          `yaml:"secure_cookies"`
+	InitialAdminPassword string        `yaml:"initial_admin_password"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Listen:    ":8080",
+		StaticDir: "./static/",
+		Database: DatabaseConfig{
+			Driver:          "mssql",
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		Upload: UploadConfig{MaxImageBytes: 5 << 20, MaxImageWidth: 4096, MaxImageHeight: 4096},
+		CORS:   CORSConfig{AllowedOrigins: []string{"*"}},
+		Archive: ArchiveConfig{
+			Retention:     30 * 24 * time.Hour,
+			PurgeInterval: time.Hour,
+		},
+		Auth: AuthConfig{
+			SessionTTL:    12 * time.Hour,
+			SecureCookies: true,
+		},
+		Blobs: BlobConfig{
+			Driver: "filesystem",
+			Dir:    "./blobs",
+			S3:     S3Config{Region: "us-east-1"},
+		},
+	}
+}
+
+// setting is one option that can be given as a flag or an environment
+// variable. Both override the config file; flags override the environment.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	apply func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"listen", "MEDICAL_LISTEN", "HTTP listen address", func(c *Config, v string) error {
+		c.Listen = v
+		return nil
+	}},
+	{"static-dir", "MEDICAL_STATIC_DIR", "directory with the web UI", func(c *Config, v string) error {
+		c.StaticDir = v
+		return nil
+	}},
+	{"db-driver", "MEDICAL_DB_DRIVER", "database backend: mssql or sqlite", func(c *Config, v string) error {
+		c.Database.Driver = v
+		return nil
+	}},
+	{"db-dsn", "MEDICAL_DB_DSN", "database connection string, or SQLite file path", func(c *Config, v string) error {
+		c.Database.DSN = v
+		return nil
+	}},
+	{"db-max-open-conns", "MEDICAL_DB_MAX_OPEN_CONNS", "maximum open database connections", func(c *Config, v string) (err error) {
+		c.Database.MaxOpenConns, err = strconv.Atoi(v)
+		return err
+	}},
+	{"db-max-idle-conns", "MEDICAL_DB_MAX_IDLE_CONNS", "maximum idle database connections", func(c *Config, v string) (err error) {
+		c.Database.MaxIdleConns, err = strconv.Atoi(v)
+		return err
+	}},
+	{"db-conn-max-lifetime", "MEDICAL_DB_CONN_MAX_LIFETIME", "maximum lifetime of a database connection, e.g. 30m", func(c *Config, v string) (err error) {
+		c.Database.ConnMaxLifetime, err = time.ParseDuration(v)
+		return err
+	}},
+	{"db-auto-migrate", "MEDICAL_DB_AUTO_MIGRATE", "apply pending migrations at startup (true or false)", func(c *Config, v string) (err error) {
+		c.Database.AutoMigrate, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"max-image-bytes", "MEDICAL_MAX_IMAGE_BYTES", "maximum size of an uploaded worker image", func(c *Config, v string) (err error) {
+		c.Upload.MaxImageBytes, err = strconv.ParseInt(v, 10, 64)
+		return err
+	}},
+	{"max-image-width", "MEDICAL_MAX_IMAGE_WIDTH", "maximum width of an uploaded worker image in pixels", func(c *Config, v string) (err error) {
+		c.Upload.MaxImageWidth, err = strconv.Atoi(v)
+		return err
+	}},
+	{"max-image-height", "MEDICAL_MAX_IMAGE_HEIGHT", "maximum height of an uploaded worker image in pixels", func(c *Config, v string) (err error) {
+		c.Upload.MaxImageHeight, err = strconv.Atoi(v)
+		return err
+	}},
+	{"cors-origins", "MEDICAL_CORS_ORIGINS", "comma-separated allowed CORS origins, * for any", func(c *Config, v string) error {
+		c.CORS.AllowedOrigins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.CORS.AllowedOrigins = append(c.CORS.AllowedOrigins, origin)
+			}
+		}
+		return nil
+	}},
+	{"archive-retention", "MEDICAL_ARCHIVE_RETENTION", "how long deleted workers can be restored before they are purged, e.g. 720h; 0 keeps them", func(c *Config, v string) (err error) {
+		c.Archive.Retention, err = time.ParseDuration(v)
+		return err
+	}},
+	{"archive-purge-interval", "MEDICAL_ARCHIVE_PURGE_INTERVAL", "how often expired archived workers are purged", func(c *Config, v string) (err error) {
+		c.Archive.PurgeInterval, err = time.ParseDuration(v)
+		return err
+	}},
+	{"session-ttl", "MEDICAL_SESSION_TTL", "how long a login session lasts, e.g. 12h", func(c *Config, v string) (err error) {
+		c.Auth.SessionTTL, err = time.ParseDuration(v)
+		return err
+	}},
+	{"secure-cookies", "MEDICAL_SECURE_COOKIES", "send session cookies over HTTPS only (true or false)", func(c *Config, v string) (err error) {
+		c.Auth.SecureCookies, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"initial-admin-password", "MEDICAL_INITIAL_ADMIN_PASSWORD", "password of the admin user created when there are no users", func(c *Config, v string) error {
+		c.Auth.InitialAdminPassword = v
+		return nil
+	}},
+	{"blob-driver", "MEDICAL_BLOB_DRIVER", "where worker images are stored: filesystem or s3", func(c *Config, v string) error {
+		c.Blobs.Driver = v
+		return nil
+	}},
+	{"blob-dir", "MEDICAL_BLOB_DIR", "directory of worker images for the filesystem blob driver", func(c *Config, v string) error {
+		c.Blobs.Dir = v
+		return nil
+	}},
+	{"s3-endpoint", "MEDICAL_S3_ENDPOINT", "S3 endpoint URL, e.g. https://s3.eu-central-1.amazonaws.com or http://localhost:9000", func(c *Config, v string) error {
+		c.Blobs.S3.Endpoint = v
+		return nil
+	}},
+	{"s3-region", "MEDICAL_S3_REGION", "S3 region", func(c *Config, v string) error {
+		c.Blobs.S3.Region = v
+		return nil
+	}},
+	{"s3-bucket", "MEDICAL_S3_BUCKET", "S3 bucket of worker images", func(c *Config, v string) error {
+		c.Blobs.S3.Bucket = v
+		return nil
+	}},
+	{"s3-prefix", "MEDICAL_S3_PREFIX", "prefix of the S3 object keys, e.g. images/", func(c *Config, v string) error {
+		c.Blobs.S3.Prefix = v
+		return nil
+	}},
+	{"s3-access-key", "MEDICAL_S3_ACCESS_KEY", "S3 access key ID", func(c *Config, v string) error {
+		c.Blobs.S3.AccessKey = v
+		return nil
+	}},
+	{"s3-secret-key", "MEDICAL_S3_SECRET_KEY", "S3 secret access key", func(c *Config, v string) error {
+		c.Blobs.S3.SecretKey = v
+		return nil
+	}},
+}
+
+// loadConfig builds the configuration from, in increasing precedence: the
+// defaults, the YAML file given by -config or MEDICAL_CONFIG, environment
+// variables and command line flags.
+func loadConfig(fs *flag.FlagSet, args []string) (*Config, bool, error) {
+	configPath := fs.String("config", "", "path to a YAML config file (env MEDICAL_CONFIG)")
+	printConfig := fs.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	flagValues := map[string]*string{}
+	for _, s := range settings {
+		flagValues[s.flag] = fs.String(s.flag, "", s.usage+" (env "+s.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+
+	cfg := defaultConfig()
+	if *configPath == "" {
+		*configPath = os.Getenv("MEDICAL_CONFIG")
+	}
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, false, fmt.Errorf("parsing %s: %w", *configPath, err)
+		}
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(s.env); ok {
+			if err := s.apply(&cfg, v); err != nil {
+				return nil, false, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+	}
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && flagErr == nil {
+				if err := s.apply(&cfg, *flagValues[s.flag]); err != nil {
+					flagErr = fmt.Errorf("invalid -%s: %w", s.flag, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, false, flagErr
+	}
+	return &cfg, *printConfig, cfg.validate()
+}
+
+func (c *Config) validate() error {
+	switch c.Database.Driver {
+	case "mssql":
+		if c.Database.DSN == "" {
+			return fmt.Errorf("database dsn is required for the mssql driver")
+		}
+	case "sqlite":
+		if c.Database.DSN == "" {
+			c.Database.DSN = "medical.db"
+		}
+	default:
+		return fmt.Errorf("unknown database driver %q", c.Database.Driver)
+	}
+	if c.Upload.MaxImageBytes <= 0 {
+		return fmt.Errorf("max image bytes must be positive")
+	}
+	if c.Upload.MaxImageWidth < minImageSide || c.Upload.MaxImageHeight < minImageSide {
+		return fmt.Errorf("max image width and height must be at least %d", minImageSide)
+	}
+	if c.Archive.Retention < 0 {
+		return fmt.Errorf("archive retention must not be negative")
+	}
+	if c.Archive.Retention > 0 && c.Archive.PurgeInterval <= 0 {
+		return fmt.Errorf("archive purge interval must be positive")
+	}
+	if c.Auth.SessionTTL <= 0 {
+		return fmt.Errorf("session ttl must be positive")
+	}
+	if c.Auth.InitialAdminPassword != "" {
+		if err := checkPassword(c.Auth.InitialAdminPassword); err != nil {
+			return fmt.Errorf("initial admin password %w", err)
+		}
+	}
+	switch c.Blobs.Driver {
+	case "filesystem":
+		if c.Blobs.Dir == "" {
+			return fmt.Errorf("blob dir is required for the filesystem blob driver")
+		}
+	case "s3":
+		s3 := c.Blobs.S3
+		if u, err := url.Parse(s3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("s3 endpoint must be an http or https URL")
+		}
+		if s3.Region == "" || s3.Bucket == "" || s3.AccessKey == "" || s3.SecretKey == "" {
+			return fmt.Errorf("s3 region, bucket, access key and secret key are required for the s3 blob driver")
+		}
+		if strings.Trim(s3.Bucket+s3.Prefix, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./") != "" {
+			return fmt.Errorf("s3 bucket and prefix may only contain letters, digits and -_./")
+		}
+	default:
+		return fmt.Errorf("unknown blob driver %q", c.Blobs.Driver)
+	}
+	return nil
+}
+
+// Redacted returns the configuration as YAML with the passwords removed.
+func (c Config) Redacted() string {
+	c.Database.DSN = redactDSN(c.Database.DSN)
+	if c.Auth.InitialAdminPassword != "" {
+		c.Auth.InitialAdminPassword = "REDACTED"
+	}
+	if c.Blobs.S3.SecretKey != "" {
+		c.Blobs.S3.SecretKey = "REDACTED"
+	}
+	data, _ := yaml.Marshal(c)
+	return string(data)
+}
+
+// redactDSN hides passwords in both the "key=value;" and the URL form of a
+// SQL Server connection string.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" && u.Host != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		}
+		q := u.Query()
+		for key := range q {
+			if isSecretKey(key) {
+				q.Set(key, "REDACTED")
+			}
+		}
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	parts := strings.Split(dsn, ";")
+	for i, part := range parts {
+		key, _, found := strings.Cut(part, "=")
+		if found && isSecretKey(strings.TrimSpace(key)) {
+			parts[i] = key + "=REDACTED"
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+func isSecretKey(key string) bool {
+	switch strings.ToLower(key) {
+	case "password", "pwd":
+		return true
+	}
+	return false
+}
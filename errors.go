@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+)
+
+// APIError is the JSON body of every error response. Code is a stable
+// machine-readable identifier, Message is meant for people.
+type APIError struct {
+	Status     int            `json:"-"`
+	Code       string         `json:"error"`
+	Message    string         `json:"message"`
+	Fields     FieldErrors    `json:"fields,omitempty"`
+	References map[string]int `json:"references,omitempty"`
+	// Current, RowVersion and Diff describe the stored record after a
+	// concurrency conflict.
+	Current    interface{} `json:"current,omitempty"`
+	RowVersion string      `json:"row_version,omitempty"`
+	Diff       []FieldDiff `json:"diff,omitempty"`
+	RequestID  string      `json:"request_id,omitempty"`
+	// Err is the underlying cause. It is logged for server errors and never
+	// sent to the client.
+	Err error `json:"-"`
+}
+
+// FieldDiff is a field whose submitted value differs from the stored one.
+type FieldDiff struct {
+	Field     string      `json:"field"`
+	Submitted interface{} `json:"submitted"`
+	Current   interface{} `json:"current"`
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func newAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func badRequest(message string) *APIError {
+	return newAPIError(http.StatusBadRequest, "BAD_REQUEST", message)
+}
+
+func notFound(entity string) *APIError {
+	return newAPIError(http.StatusNotFound, "NOT_FOUND", entity+" not found")
+}
+
+func unauthorized(message string) *APIError {
+	return newAPIError(http.StatusUnauthorized, "UNAUTHORIZED", message)
+}
+
+func forbidden() *APIError {
+	return newAPIError(http.StatusForbidden, "FORBIDDEN", "Your role does not permit this action")
+}
+
+func invalidCSRFToken() *APIError {
+	return newAPIError(http.StatusForbidden, "CSRF_TOKEN_INVALID", "Missing or invalid X-CSRF-Token header")
+}
+
+func insufficientScope(scope string) *APIError {
+	return newAPIError(http.StatusForbidden, "INSUFFICIENT_SCOPE", "The API token lacks the "+scope+" scope")
+}
+
+func methodNotAllowed() *APIError {
+	return newAPIError(http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+}
+
+func fileTooLarge(limit int64) *APIError {
+	return newAPIError(http.StatusRequestEntityTooLarge, "FILE_TOO_LARGE",
+		fmt.Sprintf("File too large, the limit is %d bytes", limit))
+}
+
+func preconditionFailed() *APIError {
+	return newAPIError(http.StatusPreconditionFailed, "PRECONDITION_FAILED",
+		"The record does not match the If-Match header; it has been modified or deleted.")
+}
+
+func unsupportedMediaType(message string) *APIError {
+	return newAPIError(http.StatusUnsupportedMediaType, "UNSUPPORTED_MEDIA_TYPE", message)
+}
+
+func invalidFilter(err error) *APIError {
+	e := newAPIError(http.StatusBadRequest, "INVALID_FILTER", "One or more query parameters are invalid.")
+	e.Fields, _ = err.(FieldErrors)
+	return e
+}
+
+func validationFailed(err error) *APIError {
+	e := newAPIError(http.StatusUnprocessableEntity, "VALIDATION_ERROR", "One or more fields are invalid.")
+	e.Fields, _ = err.(FieldErrors)
+	return e
+}
+
+func internalError(message string, err error) *APIError {
+	e := newAPIError(http.StatusInternalServerError, "INTERNAL_ERROR", message)
+	e.Err = err
+	return e
+}
+
+// storeError maps an error returned by a store to a response. entity names
+// the record in messages, e.g. "Worker".
+func storeError(err error, entity string) *APIError {
+	switch err {
+	case ErrNotFound:
+		return notFound(entity)
+	case ErrBadRowVersion:
+		return newAPIError(http.StatusBadRequest, "INVALID_ROW_VERSION", "Invalid row_version format")
+	case ErrConflict:
+		return newAPIError(http.StatusConflict, "CONCURRENCY_CONFLICT",
+			"This record has been modified by another user since you loaded it. Please reload and try again.")
+	case ErrDuplicate:
+		return newAPIError(http.StatusConflict, "DUPLICATE_VALUE", "A record with the same unique value already exists.")
+	case ErrInUse:
+		return newAPIError(http.StatusConflict, "CONSTRAINT_ERROR", entity+" is referenced by other records.")
+	case ErrInvalidReference:
+		return newAPIError(http.StatusUnprocessableEntity, "INVALID_REFERENCE", "A referenced record does not exist.")
+	case ErrTooLong:
+		return newAPIError(http.StatusUnprocessableEntity, "VALUE_TOO_LONG", "A value is longer than the database column allows.")
+	}
+	return internalError("Database error", err)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, e *APIError) {
+	e.RequestID = requestID(r.Context())
+	if e.Status >= http.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %s: %v", e.RequestID, r.Method, r.URL.Path, e.Message, e.Err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(e)
+}
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	actorKey
+	sessionKey
+)
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestID tags the request with the caller's X-Request-ID, or a new
+// random one, and echoes it in the response.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get("X-Request-ID")
+	if !validRequestID.MatchString(id) {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	w.Header().Set("X-Request-ID", id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+}
+
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Worker resources carry their row_version as a strong entity tag, so that
+// If-Match and If-None-Match give the same concurrency guarantees as the
+// row_version field of a request body.
+
+func rowVersionETag(rowVersion string) string {
+	return `"` + rowVersion + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header lists etag.
+// With weak set, W/ prefixes are ignored as RFC 9110 requires for
+// If-None-Match; If-Match uses strong comparison.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// workerIfMatch checks the If-Match header of a write against the stored
+// worker. It returns the row version the write must be guarded with, or ""
+// when the request has no If-Match header.
+func (s *server) workerIfMatch(r *http.Request, id int) (string, *APIError) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return "", nil
+	}
+	current, err := s.workers.GetWorker(r.Context(), id)
+	if err == ErrNotFound {
+		// A precondition on a missing resource can never hold.
+		return "", preconditionFailed()
+	}
+	if err != nil {
+		return "", storeError(err, "Worker")
+	}
+	if !etagMatches(header, rowVersionETag(current.RowVersion), false) {
+		return "", preconditionFailed()
+	}
+	return current.RowVersion, nil
+}
+
+// versionedWriteError reports a failed guarded write; a lost race after a
+// passing If-Match is still a failed precondition.
+func versionedWriteError(r *http.Request, err error) *APIError {
+	if err == ErrConflict && r.Header.Get("If-Match") != "" {
+		return preconditionFailed()
+	}
+	return workerWriteError(err)
+}
+
+// Worker images are tagged with their key, the SHA-256 of their content. At
+// a URL versioned by the key of the original an image never changes, so it
+// may be cached for good; elsewhere caches must revalidate it.
+
+func imageETag(img *WorkerImage) string {
+	return `"` + img.Key + `"`
+}
+
+func setImageCaching(w http.ResponseWriter, r *http.Request, img *WorkerImage) {
+	w.Header().Set("ETag", imageETag(img))
+	if !img.UpdatedAt.IsZero() {
+		w.Header().Set("Last-Modified", img.UpdatedAt.UTC().Format(http.TimeFormat))
+	}
+	v := r.URL.Query().Get("v")
+	if len(v) == imageVersionLength && strings.HasPrefix(img.Version, v) {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+}
+
+// imageNotModified evaluates If-None-Match, or If-Modified-Since when there
+// is none, against an image.
+func imageNotModified(r *http.Request, img *WorkerImage) bool {
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		return etagMatches(header, imageETag(img), true)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || img.UpdatedAt.IsZero() {
+		return false
+	}
+	return !img.UpdatedAt.Truncate(time.Second).After(since)
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestETagMatches(t *testing.T) {
+	const etag = `"0x00000000000007D1"`
+	tests := []struct {
+		header      string
+		strong      bool
+		weak        bool
+		description string
+	}{
+		{`"0x00000000000007D1"`, true, true, "same tag"},
+		{`"0x00000000000007D2"`, false, false, "other tag"},
+		{`W/"0x00000000000007D1"`, false, true, "weak tag"},
+		{`W/"0x00000000000007D2"`, false, false, "other weak tag"},
+		{`*`, true, true, "any"},
+		{` * `, true, true, "any with spaces"},
+		{`"a", "0x00000000000007D1"`, true, true, "in a list"},
+		{`"a",W/"0x00000000000007D1" ,"b"`, false, true, "weak in a list"},
+		{`"a", *`, true, true, "any in a list"},
+		{`"a", "b"`, false, false, "not in a list"},
+		{`0x00000000000007D1`, false, false, "unquoted"},
+		{`"0x00000000000007d1"`, false, false, "other case"},
+		{``, false, false, "empty"},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag, false); got != tt.strong {
+			t.Errorf("%s: strong comparison of %q = %v, want %v", tt.description, tt.header, got, tt.strong)
+		}
+		if got := etagMatches(tt.header, etag, true); got != tt.weak {
+			t.Errorf("%s: weak comparison of %q = %v, want %v", tt.description, tt.header, got, tt.weak)
+		}
+	}
+}
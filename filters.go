@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(parts, "; ")
+}
+
+// orNil returns nil for an empty list, so that the result can be returned as
+// an error.
+func (e FieldErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// filterParam describes one supported query string filter.
+type filterParam struct {
+	name  string
+	parse func(string) (interface{}, error)
+}
+
+var workerFilters = []filterParam{
+	{"department_id", parseID},
+	{"specialization_id", parseID},
+	{"facility_type_id", parseID},
+	{"hire_date_from", parseDate},
+	{"hire_date_to", parseDate},
+	{"salary_min", parseAmount},
+	{"salary_max", parseAmount},
+	{"name", parseNamePrefix},
+	{"include_archived", parseBool},
+	{"as_of", parseTimeTo},
+}
+
+var departmentFilters = []filterParam{
+	{"facility_type_id", parseID},
+	{"name", parseNamePrefix},
+}
+
+// departmentDeleteParams are the options of a department delete.
+var departmentDeleteParams = []filterParam{
+	{"reassign_to", parseID},
+	{"dry_run", parseBool},
+}
+
+var auditFilters = []filterParam{
+	{"entity", parseAuditEntity},
+	{"entity_id", parseID},
+	{"action", parseText},
+	{"actor", parseText},
+	{"request_id", parseText},
+	{"from", parseTimeFrom},
+	{"to", parseTimeTo},
+	{"limit", parseLimit},
+	{"offset", parseOffset},
+}
+
+var departmentStatFilters = []filterParam{
+	{"facility_type_id", parseID},
+}
+
+var facilityTypeFilters = []filterParam{
+	{"name", parseNamePrefix},
+}
+
+var specializationFilters = []filterParam{
+	{"category", parseText},
+	{"name", parseNamePrefix},
+}
+
+// Filter conditions by query parameter. Every "?" is replaced with the bound
+// @pN parameter of the parsed value.
+var (
+	workerFilterConds = map[string]string{
+		"department_id":     "department_id = ?",
+		"specialization_id": "specialization_id = ?",
+		"facility_type_id":  "department_id IN (SELECT department_id FROM departments WHERE facility_type_id = ?)",
+		"hire_date_from":    "hire_date >= ?",
+		"hire_date_to":      "hire_date <= ?",
+		"salary_min":        "salary >= ?",
+		"salary_max":        "salary <= ?",
+		"name":              `(first_name LIKE ? ESCAPE '\' OR last_name LIKE ? ESCAPE '\')`,
+	}
+	departmentFilterConds = map[string]string{
+		"facility_type_id": "d.facility_type_id = ?",
+		"name":             `d.department_name LIKE ? ESCAPE '\'`,
+	}
+	auditFilterConds = map[string]string{
+		"entity":     "entity = ?",
+		"entity_id":  "entity_id = ?",
+		"action":     "action = ?",
+		"actor":      "actor = ?",
+		"request_id": "request_id = ?",
+		"from":       "occurred_at >= ?",
+		"to":         "occurred_at < ?",
+	}
+	facilityTypeFilterConds = map[string]string{
+		"name": `type_name LIKE ? ESCAPE '\'`,
+	}
+	specializationFilterConds = map[string]string{
+		"category": "category = ?",
+		"name":     `specialization_name LIKE ? ESCAPE '\'`,
+	}
+)
+
+// Filters holds validated filter values keyed by query parameter name.
+type Filters map[string]interface{}
+
+// rangeChecks lists filter pairs whose lower bound must not exceed the upper one.
+var rangeChecks = [][2]string{
+	{"hire_date_from", "hire_date_to"},
+	{"salary_min", "salary_max"},
+	{"from", "to"},
+}
+
+type queryBuilder struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (qb *queryBuilder) bind(value interface{}) string {
+	qb.args = append(qb.args, value)
+	return fmt.Sprintf("@p%d", len(qb.args))
+}
+
+func (qb *queryBuilder) where(cond string, value interface{}) {
+	qb.conditions = append(qb.conditions, strings.ReplaceAll(cond, "?", qb.bind(value)))
+}
+
+func (qb *queryBuilder) whereClause() string {
+	if len(qb.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(qb.conditions, " AND ")
+}
+
+// parseFilters validates the query values against params. All malformed
+// values are reported together.
+func parseFilters(values url.Values, params []filterParam) (Filters, error) {
+	var errs FieldErrors
+	filters := Filters{}
+	for _, p := range params {
+		raw := strings.TrimSpace(values.Get(p.name))
+		if raw == "" {
+			continue
+		}
+		v, err := p.parse(raw)
+		if err != nil {
+			errs = append(errs, FieldError{Field: p.name, Message: err.Error()})
+			continue
+		}
+		filters[p.name] = v
+	}
+	for _, rc := range rangeChecks {
+		lo, okLo := filters[rc[0]]
+		hi, okHi := filters[rc[1]]
+		if okLo && okHi && lessValue(hi, lo) {
+			errs = append(errs, FieldError{Field: rc[1], Message: "must not be less than " + rc[0]})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return filters, nil
+}
+
+// applyFilters adds the condition of every present filter, in a stable order
+// so that the generated SQL is the same for the same request.
+func (qb *queryBuilder) applyFilters(filters Filters, conds map[string]string) {
+	names := make([]string, 0, len(filters))
+	for name := range filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if cond, ok := conds[name]; ok {
+			qb.where(cond, filters[name])
+		}
+	}
+}
+
+// inDepartments limits the query to the "department_ids" filter, which
+// handlers set for callers who see only some departments.
+func (qb *queryBuilder) inDepartments(filters Filters, column string) {
+	ids, ok := filters["department_ids"].([]int)
+	if !ok {
+		return
+	}
+	if len(ids) == 0 {
+		qb.conditions = append(qb.conditions, "1 = 0")
+		return
+	}
+	params := make([]string, len(ids))
+	for i, id := range ids {
+		params[i] = qb.bind(id)
+	}
+	qb.conditions = append(qb.conditions, column+" IN ("+strings.Join(params, ", ")+")")
+}
+
+func lessValue(a, b interface{}) bool {
+	switch av := a.(type) {
+	case float64:
+		return av < b.(float64)
+	case string:
+		return av < b.(string)
+	}
+	return false
+}
+
+func parseID(s string) (interface{}, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("must be a positive integer")
+	}
+	return id, nil
+}
+
+func parseDate(s string) (interface{}, error) {
+	if _, err := time.Parse("2006-01-02", s); err != nil {
+		return nil, fmt.Errorf("must be a date in YYYY-MM-DD format")
+	}
+	return s, nil
+}
+
+func parseAmount(s string) (interface{}, error) {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return nil, fmt.Errorf("must be a non-negative number")
+	}
+	return v, nil
+}
+
+func parseBool(s string) (interface{}, error) {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return nil, fmt.Errorf("must be true or false")
+	}
+	return v, nil
+}
+
+func parseAuditEntity(s string) (interface{}, error) {
+	for _, entity := range auditEntities {
+		if s == entity {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("must be one of %s", strings.Join(auditEntities, ", "))
+}
+
+// parseTimeFrom and parseTimeTo accept a date or an RFC 3339 time and return
+// it in the format of dbTime. The upper bound is inclusive: a date includes
+// the whole day.
+func parseTimeFrom(s string) (interface{}, error) {
+	return parseTime(s, false)
+}
+
+func parseTimeTo(s string) (interface{}, error) {
+	return parseTime(s, true)
+}
+
+func parseTime(s string, endOfDay bool) (interface{}, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return dbTime(t), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("must be a date (YYYY-MM-DD) or an RFC 3339 time")
+	}
+	if endOfDay {
+		t = t.Add(time.Second)
+	}
+	return dbTime(t), nil
+}
+
+func parseLimit(s string) (interface{}, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > maxPageSize {
+		return nil, fmt.Errorf("must be an integer between 1 and %d", maxPageSize)
+	}
+	return n, nil
+}
+
+func parseOffset(s string) (interface{}, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("must be a non-negative integer")
+	}
+	return n, nil
+}
+
+func parseText(s string) (interface{}, error) {
+	if len(s) > 100 {
+		return nil, fmt.Errorf("must be at most 100 characters")
+	}
+	return s, nil
+}
+
+func parseNamePrefix(s string) (interface{}, error) {
+	if len(s) > 100 {
+		return nil, fmt.Errorf("must be at most 100 characters")
+	}
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`, `[`, `\[`)
+	return r.Replace(s) + "%", nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFilters(t *testing.T) {
+	tests := []struct {
+		query  string
+		want   Filters
+		fields []string
+	}{
+		{"", Filters{}, nil},
+		{"department_id=3&salary_min=1000.5&include_archived=true",
+			Filters{"department_id": 3, "salary_min": 1000.5, "include_archived": true}, nil},
+		{"hire_date_from=2020-01-01&hire_date_to=2020-12-31",
+			Filters{"hire_date_from": "2020-01-01", "hire_date_to": "2020-12-31"}, nil},
+		{"name=+Ив+", Filters{"name": "Ив%"}, nil},
+		{"name=50%25_off[1]", Filters{"name": `50\%\_off\[1]%`}, nil},
+		{"unknown=1&sort=salary", Filters{}, nil},
+		{"department_id=0", nil, []string{"department_id"}},
+		{"department_id=1 OR 1=1", nil, []string{"department_id"}},
+		{"salary_min=-1&hire_date_from=yesterday&include_archived=maybe",
+			nil, []string{"hire_date_from", "salary_min", "include_archived"}},
+		{"salary_min=10&salary_max=5", nil, []string{"salary_max"}},
+		{"hire_date_from=2021-01-01&hire_date_to=2020-01-01", nil, []string{"hire_date_to"}},
+		{"name=" + strings.Repeat("a", 101), nil, []string{"name"}},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		filters, err := parseFilters(values, workerFilters)
+		if tt.fields == nil {
+			if err != nil || !reflect.DeepEqual(filters, tt.want) {
+				t.Errorf("%q: got %v, %v; want %v", tt.query, filters, err, tt.want)
+			}
+			continue
+		}
+		var errs FieldErrors
+		if !errors.As(err, &errs) {
+			t.Errorf("%q: error %v, want field errors", tt.query, err)
+			continue
+		}
+		var fields []string
+		for _, fe := range errs {
+			fields = append(fields, fe.Field)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%q: errors for %v, want %v", tt.query, fields, tt.fields)
+		}
+	}
+}
+
+// TestFiltersAreBound checks that filter values only ever reach the query as
+// bound parameters, whatever they contain.
+func TestFiltersAreBound(t *testing.T) {
+	hostile := []string{
+		"x' OR '1'='1",
+		"'; DROP TABLE medical_workers; --",
+		"Robert\"); DELETE FROM users; --",
+		"@p9 --",
+		"? OR ?",
+	}
+	for _, value := range hostile {
+		values := url.Values{"name": {value}, "category": {value}, "actor": {value}}
+		for _, set := range []struct {
+			params []filterParam
+			conds  map[string]string
+		}{
+			{workerFilters, workerFilterConds},
+			{specializationFilters, specializationFilterConds},
+			{auditFilters, auditFilterConds},
+		} {
+			filters, err := parseFilters(values, set.params)
+			if err != nil {
+				t.Fatalf("%q: %v", value, err)
+			}
+			qb := &queryBuilder{}
+			qb.applyFilters(filters, set.conds)
+			where := qb.whereClause()
+			if strings.Contains(where, value) || strings.Contains(where, "'") && !strings.Contains(where, `ESCAPE '\'`) {
+				t.Errorf("%q leaked into %s", value, where)
+			}
+			if len(qb.args) == 0 {
+				t.Errorf("%q: no bound arguments for %s", value, where)
+			}
+			for name, v := range filters {
+				found := false
+				for _, arg := range qb.args {
+					found = found || arg == v
+				}
+				if !found {
+					t.Errorf("%q: %s is not a bound argument of %s", value, name, where)
+				}
+			}
+		}
+	}
+
+	qb := &queryBuilder{}
+	qb.applyFilters(Filters{"department_id": 3, "salary_min": 10.0, "name": "a%"}, workerFilterConds)
+	want := " WHERE department_id = @p1 AND (first_name LIKE @p2 ESCAPE '\\' OR last_name LIKE @p2 ESCAPE '\\') AND salary >= @p3"
+	if qb.whereClause() != want || !reflect.DeepEqual(qb.args, []interface{}{3, "a%", 10.0}) {
+		t.Errorf("got %s with %v", qb.whereClause(), qb.args)
+	}
+}
+
+func TestFiltersAgainstDatabase(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"Sarah", 1},
+		{"sarah", 1},
+		{"x' OR '1'='1", 0},
+		{"' OR 1=1 --", 0},
+		{"%", 0},
+		{"_", 0},
+	}
+	for _, tt := range tests {
+		filters, err := parseFilters(url.Values{"name": {tt.name}}, workerFilters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := store.ListWorkers(ctx, filters, &pageRequest{sort: []sortKey{{column: "worker_id"}}})
+		if err != nil {
+			t.Fatalf("%q: %v", tt.name, err)
+		}
+		if page.Total != tt.want {
+			t.Errorf("name %q matched %d workers, want %d", tt.name, page.Total, tt.want)
+		}
+	}
+	var n int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM medical_workers").Scan(&n); err != nil || n != 14 {
+		t.Errorf("%d workers left, %v", n, err)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		in       string
+		from, to string
+	}{
+		// Upper bounds are exclusive, so they move past the value given.
+		{"2024-02-28", "2024-02-28 00:00:00", "2024-02-29 00:00:00"},
+		{"2024-12-31", "2024-12-31 00:00:00", "2025-01-01 00:00:00"},
+		{"2024-03-10T12:30:00Z", "2024-03-10 12:30:00", "2024-03-10 12:30:01"},
+		{"2024-03-10T23:59:59Z", "2024-03-10 23:59:59", "2024-03-11 00:00:00"},
+		{"2024-03-10T15:30:00+03:00", "2024-03-10 12:30:00", "2024-03-10 12:30:01"},
+	}
+	for _, tt := range tests {
+		from, err := parseTimeFrom(tt.in)
+		if err != nil || from != tt.from {
+			t.Errorf("parseTimeFrom(%q) = %v, %v; want %s", tt.in, from, err, tt.from)
+		}
+		to, err := parseTimeTo(tt.in)
+		if err != nil || to != tt.to {
+			t.Errorf("parseTimeTo(%q) = %v, %v; want %s", tt.in, to, err, tt.to)
+		}
+	}
+	for _, bad := range []string{"2024-02-30", "10.03.2024", "2024-03-10 12:30:00", "now"} {
+		if _, err := parseTimeTo(bad); err == nil {
+			t.Errorf("parseTimeTo(%q) accepted", bad)
+		}
+	}
+}
+
+// TestTimeRangeIsInclusive checks the bounds against stored times: a date
+// includes its whole day and a time its whole second.
+func TestTimeRangeIsInclusive(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	err := store.RecordAudit(ctx, &AuditEntry{OccurredAt: "2024-03-10 12:30:00", Actor: "hr", Entity: auditWorker, EntityID: 1, Action: "update"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"from=2024-03-10&to=2024-03-10", 1},
+		{"to=2024-03-09", 0},
+		{"from=2024-03-11", 0},
+		{"from=2024-03-10T12:30:00Z&to=2024-03-10T12:30:00Z", 1},
+		{"to=2024-03-10T12:29:59Z", 0},
+		{"from=2024-03-10T12:30:01Z", 0},
+		{"to=2024-03-10T15:30:00%2B03:00", 1},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		filters, err := parseFilters(values, auditFilters)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if _, total, err := store.ListAudit(ctx, filters); err != nil || total != tt.want {
+			t.Errorf("%s: %d entries, %v; want %d", tt.query, total, err, tt.want)
+		}
+	}
+}
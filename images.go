@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Uploaded worker images are recognised by their content, never by the file
+// name or the Content-Type sent by the client, and must decode completely
+// within the configured dimensions. They are then stored upright, scaled down
+// to maxStoredSide and encoded again, which drops EXIF and other metadata,
+// together with smaller copies for pages that show many workers.
+
+// minImageSide is the smallest width and height accepted, in pixels.
+const minImageSide = 16
+
+// Sizes a worker image is served in.
+const (
+	imageOriginal = "original"
+	imageMedium   = "medium"
+	imageThumb    = "thumb"
+)
+
+// maxStoredSide bounds the width and height of the stored original;
+// imageVariants bound those of the resized copies.
+const maxStoredSide = 2048
+
+var imageVariants = map[string]int{imageMedium: 512, imageThumb: 128}
+
+// imageVersionLength is how much of the key of an original versions the
+// image URLs of a worker.
+const imageVersionLength = 16
+
+// workerImageURL returns the URL of the image of a worker, versioned by its
+// key so that the URL changes with the image. Images still kept in the
+// database have no key and an unversioned URL.
+func workerImageURL(workerID int, key string) string {
+	url := fmt.Sprintf("/api/medical-workers/%d/image", workerID)
+	if len(key) >= imageVersionLength {
+		url += "?v=" + key[:imageVersionLength]
+	}
+	return url
+}
+
+const jpegQuality = 85
+
+// sniffImage returns the MIME type of a JPEG, PNG or WebP file from its
+// signature, "" for anything else.
+func sniffImage(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	}
+	return ""
+}
+
+// checkImage validates an upload and returns it with its detected type.
+// The dimensions are read from the header first, so that an oversized image
+// is rejected before it is decoded.
+func checkImage(data []byte, limits UploadConfig) (*WorkerImage, *APIError) {
+	contentType := sniffImage(data)
+	if contentType == "" {
+		return nil, unsupportedMediaType("The image must be a JPEG, PNG or WebP file")
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != contentType {
+		return nil, unsupportedMediaType("The image file is damaged")
+	}
+	if cfg.Width < minImageSide || cfg.Height < minImageSide ||
+		cfg.Width > limits.MaxImageWidth || cfg.Height > limits.MaxImageHeight {
+		return nil, unsupportedMediaType(fmt.Sprintf("The image is %dx%d pixels; it must be from %dx%d to %dx%d",
+			cfg.Width, cfg.Height, minImageSide, minImageSide, limits.MaxImageWidth, limits.MaxImageHeight))
+	}
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		return nil, unsupportedMediaType("The image file is damaged")
+	}
+	return &WorkerImage{Data: data, ContentType: contentType}, nil
+}
+
+// processImage decodes a checked image and returns it in every size. JPEG and
+// PNG images keep their format; WebP, which cannot be encoded here, becomes
+// JPEG, or PNG when it has transparency. Resized copies are JPEG unless
+// transparent.
+func processImage(upload *WorkerImage) (map[string]*WorkerImage, error) {
+	decoded, _, err := image.Decode(bytes.NewReader(upload.Data))
+	if err != nil {
+		return nil, err
+	}
+	img := orient(scaleDown(decoded, maxStoredSide), exifOrientation(upload.Data, upload.ContentType))
+	opaque := img.Opaque()
+	images := map[string]*WorkerImage{}
+	if images[imageOriginal], err = encodeImage(img, upload.ContentType == "image/png" || !opaque); err != nil {
+		return nil, err
+	}
+	for size, side := range imageVariants {
+		if images[size], err = encodeImage(scaleDown(img, side), !opaque); err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// resizeImage makes one resized copy of a stored image.
+func resizeImage(original *WorkerImage, size string) (*WorkerImage, error) {
+	decoded, _, err := image.Decode(bytes.NewReader(original.Data))
+	if err != nil {
+		return nil, err
+	}
+	img := orient(scaleDown(decoded, imageVariants[size]), exifOrientation(original.Data, original.ContentType))
+	return encodeImage(img, !img.Opaque())
+}
+
+func encodeImage(img *image.RGBA, asPNG bool) (*WorkerImage, error) {
+	var buf bytes.Buffer
+	if asPNG {
+		err := png.Encode(&buf, img)
+		return &WorkerImage{Data: buf.Bytes(), ContentType: "image/png"}, err
+	}
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	return &WorkerImage{Data: buf.Bytes(), ContentType: "image/jpeg"}, err
+}
+
+// scaleDown fits an image into side x side pixels, keeping its aspect ratio;
+// smaller images are only converted to RGBA.
+func scaleDown(src image.Image, side int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > side || h > side {
+		if w >= h {
+			w, h = side, max(1, h*side/w)
+		} else {
+			w, h = max(1, w*side/h), side
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if w == b.Dx() && h == b.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	} else {
+		draw.BiLinear.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	}
+	return dst
+}
+
+// orient turns an image upright according to its EXIF orientation: 2 to 4
+// mirror or rotate by 180 degrees, 5 to 8 also swap the axes.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if orientation >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):][:4])
+		}
+	}
+	return dst
+}
+
+// exifOrientation returns the orientation tag of the EXIF data of an image,
+// 1 (upright) when there is none.
+func exifOrientation(data []byte, contentType string) int {
+	tiff := exifData(data, contentType)
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
+
+// exifData finds the EXIF block (a TIFF structure) of a JPEG, PNG or WebP
+// file.
+func exifData(data []byte, contentType string) []byte {
+	switch contentType {
+	case "image/jpeg":
+		// Segments up to the image data: FF, marker, big-endian length.
+		for i := 2; i+4 <= len(data) && data[i] == 0xff; {
+			marker := data[i+1]
+			end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+			if marker == 0xda || end > len(data) {
+				break
+			}
+			if segment := data[i+4 : end]; marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				return segment[6:]
+			}
+			i = end
+		}
+	case "image/png":
+		// Chunks after the signature: length, type, data, CRC.
+		for i := 8; i+12 <= len(data); {
+			end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+			if end > len(data) || end < i {
+				break
+			}
+			if string(data[i+4:i+8]) == "eXIf" {
+				return data[i+8 : end-4]
+			}
+			i = end
+		}
+	case "image/webp":
+		// RIFF chunks after the header: type, little-endian length, data
+		// padded to an even length.
+		for i := 12; i+8 <= len(data); {
+			size := int(binary.LittleEndian.Uint32(data[i+4:]))
+			end := i + 8 + size
+			if end > len(data) || end < i {
+				break
+			}
+			if string(data[i:i+4]) == "EXIF" {
+				return bytes.TrimPrefix(data[i+8:end], []byte("Exif\x00\x00"))
+			}
+			i = end + size%2
+		}
+	}
+	return nil
+}
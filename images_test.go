@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withPNGSize rewrites the dimensions in the IHDR chunk of a PNG file and
+// its checksum, leaving the image data as it was.
+func withPNGSize(data []byte, w, h uint32) []byte {
+	out := append([]byte(nil), data...)
+	ihdr := out[8:]
+	binary.BigEndian.PutUint32(ihdr[8:], w)
+	binary.BigEndian.PutUint32(ihdr[12:], h)
+	binary.BigEndian.PutUint32(ihdr[21:], crc32.ChecksumIEEE(ihdr[4:21]))
+	return out
+}
+
+func TestSniffImage(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{[]byte("\xff\xd8\xff\xe0rest"), "image/jpeg"},
+		{[]byte("\x89PNG\r\n\x1a\nrest"), "image/png"},
+		{[]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), "image/webp"},
+		{[]byte("RIFF\x00\x00\x00\x00WAVEfmt "), ""},
+		{[]byte("RIFF"), ""},
+		{[]byte("GIF89a"), ""},
+		{[]byte("<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), ""},
+		{[]byte("\xff\xd8"), ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := sniffImage(tt.data); got != tt.want {
+			t.Errorf("sniffImage(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	limits := UploadConfig{MaxImageBytes: 1 << 20, MaxImageWidth: 64, MaxImageHeight: 48}
+	pngData := encodePNG(t, testImage(32, 24))
+	jpegData := encodeJPEG(t, testImage(32, 24))
+	var gifData bytes.Buffer
+	gif.Encode(&gifData, testImage(32, 24), nil)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		message     string
+	}{
+		{"png", pngData, "image/png", ""},
+		{"jpeg", jpegData, "image/jpeg", ""},
+		{"largest allowed", encodePNG(t, testImage(64, 48)), "image/png", ""},
+		{"smallest allowed", encodePNG(t, testImage(minImageSide, minImageSide)), "image/png", ""},
+		{"gif", gifData.Bytes(), "", "must be a JPEG, PNG or WebP"},
+		{"html", []byte("<html><script>alert(1)</script></html>"), "", "must be a JPEG, PNG or WebP"},
+		{"jpeg signature on a png", append([]byte("\xff\xd8\xff"), pngData...), "", "damaged"},
+		{"png signature only", []byte("\x89PNG\r\n\x1a\n"), "", "damaged"},
+		{"truncated png", pngData[:len(pngData)/2], "", "damaged"},
+		{"truncated jpeg", jpegData[:len(jpegData)/2], "", "damaged"},
+		{"too wide", encodePNG(t, testImage(65, 20)), "", "is 65x20 pixels"},
+		{"too tall", encodePNG(t, testImage(20, 49)), "", "is 20x49 pixels"},
+		{"too small", encodePNG(t, testImage(minImageSide-1, 20)), "", "is 15x20 pixels"},
+		// A header claiming a huge image is rejected before decoding.
+		{"huge header", withPNGSize(pngData, 100000, 100000), "", "is 100000x100000 pixels"},
+		{"header larger than the data", withPNGSize(pngData, 64, 48), "", "damaged"},
+	}
+	for _, tt := range tests {
+		img, apiErr := checkImage(tt.data, limits)
+		if tt.message == "" {
+			if apiErr != nil {
+				t.Errorf("%s: %s", tt.name, apiErr.Message)
+			} else if img.ContentType != tt.contentType || !bytes.Equal(img.Data, tt.data) {
+				t.Errorf("%s: got %s", tt.name, img.ContentType)
+			}
+			continue
+		}
+		if apiErr == nil {
+			t.Errorf("%s: accepted as %s", tt.name, img.ContentType)
+			continue
+		}
+		if apiErr.Status != http.StatusUnsupportedMediaType || !strings.Contains(apiErr.Message, tt.message) {
+			t.Errorf("%s: %d %q, want 415 with %q", tt.name, apiErr.Status, apiErr.Message, tt.message)
+		}
+	}
+}
+
+// imageWorkerStore records the images a handler saves for a worker.
+type imageWorkerStore struct {
+	WorkerStore
+	saved map[string]*WorkerImage
+}
+
+func (f *imageWorkerStore) SetWorkerImage(ctx context.Context, id int, images map[string]*WorkerImage) error {
+	f.saved = images
+	return nil
+}
+
+// TestUploadWorkerImage checks that an upload is judged by its content, not
+// by the file name or type the client claims, and how failures are reported.
+func TestUploadWorkerImage(t *testing.T) {
+	pngData := encodePNG(t, testImage(20, 20))
+	multipartBody := func(name string, data []byte) (string, *bytes.Buffer) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="image"; filename="`+name+`"`)
+		h.Set("Content-Type", "image/jpeg")
+		part, _ := mw.CreatePart(h)
+		part.Write(data)
+		mw.Close()
+		return mw.FormDataContentType(), &body
+	}
+	pngType, pngBody := multipartBody("photo.jpg", pngData)
+	scriptType, scriptBody := multipartBody("photo.jpg", []byte("#!/bin/sh\necho photo\n"))
+	largeType, largeBody := multipartBody("photo.png", append(pngData, make([]byte, 4096)...))
+	hugeType, hugeBody := multipartBody("photo.png", make([]byte, 2<<20))
+	tests := []struct {
+		name        string
+		contentType string
+		body        *bytes.Buffer
+		status      int
+		stored      string
+	}{
+		{"png named jpg", pngType, pngBody, http.StatusOK, "image/png"},
+		{"script named jpg", scriptType, scriptBody, http.StatusUnsupportedMediaType, ""},
+		{"file over the limit", largeType, largeBody, http.StatusRequestEntityTooLarge, ""},
+		{"body over the limit", hugeType, hugeBody, http.StatusRequestEntityTooLarge, ""},
+		{"not multipart", "text/plain", bytes.NewBufferString("hello"), http.StatusBadRequest, ""},
+		{"unterminated multipart", "multipart/form-data; boundary=xx",
+			bytes.NewBufferString("--xx\r\nContent-Disposition: form-data; name=\"image\"\r\n\r\nabc"), http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		workers := &imageWorkerStore{}
+		s := &server{
+			workers: workers,
+			blobs:   &fsBlobStore{dir: t.TempDir()},
+			upload:  UploadConfig{MaxImageBytes: 4096, MaxImageWidth: 64, MaxImageHeight: 64},
+		}
+		r := httptest.NewRequest("POST", "/api/medical-workers/1/image", tt.body)
+		r.Header.Set("Content-Type", tt.contentType)
+		r = mux.SetURLVars(r, map[string]string{"id": "1"})
+		r = r.WithContext(context.WithValue(r.Context(), sessionKey, &Session{Role: roleHR}))
+		w := httptest.NewRecorder()
+		s.uploadWorkerImage(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.stored == "" {
+			if workers.saved != nil {
+				t.Errorf("%s: image saved", tt.name)
+			}
+			continue
+		}
+		if original := workers.saved[imageOriginal]; original == nil || original.ContentType != tt.stored {
+			t.Errorf("%s: saved %v, want %s", tt.name, workers.saved, tt.stored)
+		}
+	}
+}
+
+// exifTIFF builds an EXIF block with one IFD entry, the orientation tag.
+func exifTIFF(order binary.ByteOrder, orientation uint16) []byte {
+	tiff := make([]byte, 26)
+	if order == binary.LittleEndian {
+		copy(tiff, "II*\x00")
+	} else {
+		copy(tiff, "MM\x00*")
+	}
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 1)
+	order.PutUint16(tiff[10:], 0x0112)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], orientation)
+	return tiff
+}
+
+// jpegWithEXIF inserts an APP1 segment with tiff after the SOI marker.
+func jpegWithEXIF(jpegData, tiff []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := append([]byte(nil), jpegData[:2]...)
+	out = append(out, 0xff, 0xe1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	jpegData := encodeJPEG(t, testImage(20, 20))
+	pngData := encodePNG(t, testImage(20, 20))
+
+	pngChunk := binary.BigEndian.AppendUint32(nil, uint32(len(exifTIFF(binary.BigEndian, 8))))
+	pngChunk = append(append(pngChunk, "eXIf"...), exifTIFF(binary.BigEndian, 8)...)
+	pngChunk = append(pngChunk, 0, 0, 0, 0)
+	pngWithEXIF := append(append(append([]byte(nil), pngData[:33]...), pngChunk...), pngData[33:]...)
+
+	webpEXIF := append([]byte("Exif\x00\x00"), exifTIFF(binary.LittleEndian, 3)...)
+	webp := append([]byte("RIFF\x00\x00\x00\x00WEBPVP8X"), binary.LittleEndian.AppendUint32(nil, 1)...)
+	webp = append(webp, 0, 0) // odd chunk and its padding
+	webp = append(append(webp, "EXIF"...), binary.LittleEndian.AppendUint32(nil, uint32(len(webpEXIF)))...)
+	webp = append(webp, webpEXIF...)
+
+	badOffset := exifTIFF(binary.LittleEndian, 6)
+	binary.LittleEndian.PutUint32(badOffset[4:], 1<<30)
+	lowOffset := exifTIFF(binary.LittleEndian, 6)
+	binary.LittleEndian.PutUint32(lowOffset[4:], 4)
+	manyEntries := exifTIFF(binary.LittleEndian, 6)
+	binary.LittleEndian.PutUint16(manyEntries[8:], 1000)
+	binary.LittleEndian.PutUint16(manyEntries[10:], 0x0100) // not the orientation
+	badOrder := exifTIFF(binary.LittleEndian, 6)
+	copy(badOrder, "XX")
+	badSegment := jpegWithEXIF(jpegData, exifTIFF(binary.BigEndian, 6))
+	binary.BigEndian.PutUint16(badSegment[4:], 0xffff)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		want        int
+	}{
+		{"jpeg without exif", jpegData, "image/jpeg", 1},
+		{"png without exif", pngData, "image/png", 1},
+		{"jpeg little-endian", jpegWithEXIF(jpegData, exifTIFF(binary.LittleEndian, 6)), "image/jpeg", 6},
+		{"jpeg big-endian", jpegWithEXIF(jpegData, exifTIFF(binary.BigEndian, 5)), "image/jpeg", 5},
+		{"png eXIf chunk", pngWithEXIF, "image/png", 8},
+		{"webp EXIF chunk", webp, "image/webp", 3},
+		{"ifd offset past the end", jpegWithEXIF(jpegData, badOffset), "image/jpeg", 1},
+		{"ifd offset inside the header", jpegWithEXIF(jpegData, lowOffset), "image/jpeg", 1},
+		{"entry count past the end", jpegWithEXIF(jpegData, manyEntries), "image/jpeg", 1},
+		{"unknown byte order", jpegWithEXIF(jpegData, badOrder), "image/jpeg", 1},
+		{"short exif", jpegWithEXIF(jpegData, []byte("II*\x00")), "image/jpeg", 1},
+		{"segment longer than the file", badSegment, "image/jpeg", 1},
+		{"truncated", jpegWithEXIF(jpegData, exifTIFF(binary.LittleEndian, 6))[:20], "image/jpeg", 1},
+		{"other type", jpegWithEXIF(jpegData, exifTIFF(binary.LittleEndian, 6)), "image/png", 1},
+	}
+	for _, tt := range tests {
+		if got := exifOrientation(tt.data, tt.contentType); got != tt.want {
+			t.Errorf("%s: orientation %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image whose pixels are numbered in their red channel:
+	//   1 2 3
+	//   4 5 6
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		src.Set(i%3, i/3, color.RGBA{uint8(i + 1), 0, 0, 255})
+	}
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{0, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+		{1, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+		{2, [][]uint8{{3, 2, 1}, {6, 5, 4}}},
+		{3, [][]uint8{{6, 5, 4}, {3, 2, 1}}},
+		{4, [][]uint8{{4, 5, 6}, {1, 2, 3}}},
+		{5, [][]uint8{{1, 4}, {2, 5}, {3, 6}}},
+		{6, [][]uint8{{4, 1}, {5, 2}, {6, 3}}},
+		{7, [][]uint8{{6, 3}, {5, 2}, {4, 1}}},
+		{8, [][]uint8{{3, 6}, {2, 5}, {1, 4}}},
+		{9, [][]uint8{{1, 2, 3}, {4, 5, 6}}},
+	}
+	for _, tt := range tests {
+		dst := orient(src, tt.orientation)
+		if dst.Rect.Dx() != len(tt.want[0]) || dst.Rect.Dy() != len(tt.want) {
+			t.Errorf("orientation %d: size %v", tt.orientation, dst.Rect.Size())
+			continue
+		}
+		for y, row := range tt.want {
+			for x, want := range row {
+				if got := dst.RGBAAt(x, y).R; got != want {
+					t.Errorf("orientation %d: pixel (%d,%d) is %d, want %d", tt.orientation, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+// TestProcessImageOrients checks that a rotated photo is stored upright.
+func TestProcessImageOrients(t *testing.T) {
+	data := jpegWithEXIF(encodeJPEG(t, testImage(40, 20)), exifTIFF(binary.BigEndian, 6))
+	images, err := processImage(&WorkerImage{Data: data, ContentType: "image/jpeg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(images[imageOriginal].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Width != 20 || cfg.Height != 40 {
+		t.Errorf("stored %dx%d, want 20x40", cfg.Width, cfg.Height)
+	}
+	if exifOrientation(images[imageOriginal].Data, "image/jpeg") != 1 {
+		t.Error("the stored image still has an orientation tag")
+	}
+}
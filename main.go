@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	_ "github.com/denisenkom/go-mssqldb"
@@ -16,18 +24,21 @@ import (
 	"github.com/tealeg/xlsx"
 )
 
-var db *sql.DB
-
 type FacilityType struct {
-	FacilityTypeID int    `json:"facility_type_id"`
-	TypeName       string `json:"type_name"`
-	Description    string `json:"description"`
+	FacilityTypeID        int     `json:"facility_type_id"`
+	TypeName              string  `json:"type_name"`
+	Description           *string `json:"description,omitempty"`
+	TypicalBedCapacity    *int    `json:"typical_bed_capacity,omitempty"`
+	AccreditationRequired *bool   `json:"accreditation_required,omitempty"`
 }
 
 type Specialization struct {
-	SpecializationID   int    `json:"specialization_id"`
-	SpecializationName string `json:"specialization_name"`
-	Category           string `json:"category"`
+	SpecializationID      int     `json:"specialization_id"`
+	SpecializationName    string  `json:"specialization_name"`
+	Description           *string `json:"description,omitempty"`
+	Category              *string `json:"category,omitempty"`
+	RequiredYearsTraining *int    `json:"required_years_training,omitempty"`
+	CertificationRequired *bool   `json:"certification_required,omitempty"`
 }
 
 type Department struct {
@@ -39,6 +50,7 @@ type Department struct {
 	FacilityTypeID   int     `json:"facility_type_id"`
 	FacilityTypeName string  `json:"facility_type_name"`
 	CreatedDate      *string `json:"created_date,omitempty"`
+	RowVersion       string  `json:"row_version,omitempty"`
 }
 
 type MedicalWorker struct {
@@ -55,11 +67,13 @@ type MedicalWorker struct {
 	Salary             float64 `json:"salary"`
 	LicenseNumber      string  `json:"license_number"`
 	HasImage           bool    `json:"has_image"`
+	ImageURL           string  `json:"image_url,omitempty"`
 	RowVersion         string  `json:"row_version,omitempty"`
+	DeletedAt          *string `json:"deleted_at,omitempty"`
 	Experience         string  `json:"experience,omitempty"`
 }
 
-// Add this struct with your other type definitions
+// DepartmentStat is one row of sp_GetDepartmentStatistics.
 type DepartmentStat struct {
 	DepartmentID             int      `json:"department_id"`
 	DepartmentName           string   `json:"department_name"`
@@ -80,13 +94,14 @@ type DepartmentStat struct {
 	MostCommonSpecialization *string  `json:"most_common_specialization,omitempty"`
 }
 
-func initDB() {
-	var err error
-	connString := "server=MSSERVER;user id=sa;password=123;database=B2;trusted_connection=yes;encrypt=disable;"
-	db, err = sql.Open("sqlserver", connString)
+func initDB(cfg DatabaseConfig) *sql.DB {
+	db, err := sql.Open("sqlserver", cfg.DSN)
 	if err != nil {
 		log.Fatal("Error creating connection pool: ", err.Error())
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 	err = db.Ping()
 	if err != nil {
 		log.Printf("Warning: Could not ping database: %v", err)
@@ -94,303 +109,346 @@ func initDB() {
 	} else {
 		fmt.Println("Connected to database successfully!")
 	}
+	return db
 }
 
-func hexToVarbinary(hexStr string) (interface{}, error) {
-	hexStr = strings.TrimPrefix(hexStr, "0x")
-	if hexStr == "" {
-		return nil, nil
-	}
-	bytes, err := hex.DecodeString(hexStr)
-	if err != nil {
-		return nil, err
-	}
-	return bytes, nil
+type server struct {
+	workers        WorkerStore
+	departments    DepartmentStore
+	refs           ReferenceStore
+	reports        ReportStore
+	audit          AuditStore
+	users          UserStore
+	tokens         TokenStore
+	blobs          BlobStore
+	auth           AuthConfig
+	upload         UploadConfig
+	allowedOrigins []string
 }
 
-func getWorkerImage(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	workerID := vars["id"]
-	var imageData []byte
-	err := db.QueryRow("SELECT image_data FROM medical_workers WHERE worker_id = @p1", workerID).Scan(&imageData)
+func pathID(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["id"])
+}
+
+func (s *server) getWorkerImage(w http.ResponseWriter, r *http.Request) {
+	workerID, err := pathID(r)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Worker not found", http.StatusNotFound)
-			return
-		}
-		w.WriteHeader(http.StatusNoContent)
+		writeError(w, r, badRequest("Invalid worker ID"))
+		return
+	}
+	if _, apiErr := s.visibleWorker(r, workerID); apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = imageOriginal
+	}
+	if _, ok := imageVariants[size]; !ok && size != imageOriginal {
+		writeError(w, r, badRequest("size must be thumb, medium or original"))
 		return
 	}
-	if len(imageData) == 0 {
+	img, err := s.workers.GetWorkerImage(r.Context(), workerID, size)
+	if err == nil && img == nil && size != imageOriginal {
+		img, err = s.imageVariant(r, workerID, size)
+	}
+	if err != nil {
+		writeError(w, r, storeError(err, "Worker"))
+		return
+	}
+	if img == nil {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
-	w.Header().Set("Content-Type", "image/jpeg")
-	w.Header().Set("Cache-Control", "public, max-age=3600")
-	w.Write(imageData)
+	if img.Key == "" {
+		img.Key = blobKey(img.Data)
+	}
+	if imageNotModified(r, img) {
+		setImageCaching(w, r, img)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if err := s.loadImage(r.Context(), img); err != nil {
+		writeError(w, r, internalError("Error reading image", err))
+		return
+	}
+	contentType := img.ContentType
+	if contentType == "" {
+		contentType = http.DetectContentType(img.Data)
+	}
+	setImageCaching(w, r, img)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(img.Data)
+}
+
+// imageVariant makes a missing resized copy of an image uploaded before
+// copies were made. An image that cannot be decoded is served as it is.
+func (s *server) imageVariant(r *http.Request, workerID int, size string) (*WorkerImage, error) {
+	original, err := s.workers.GetWorkerImage(r.Context(), workerID, imageOriginal)
+	if err != nil || original == nil {
+		return nil, err
+	}
+	if err := s.loadImage(r.Context(), original); err != nil {
+		return nil, err
+	}
+	if original.ContentType == "" {
+		original.ContentType = http.DetectContentType(original.Data)
+	}
+	img, err := resizeImage(original, size)
+	if err != nil {
+		log.Printf("[%s] Error resizing the image of worker %d: %v", requestID(r.Context()), workerID, err)
+		return original, nil
+	}
+	img.Version, img.UpdatedAt = original.Version, original.UpdatedAt
+	err = s.putImage(r.Context(), img)
+	if err == nil {
+		err = s.workers.AddImageVariant(r.Context(), workerID, size, img)
+	}
+	if err != nil {
+		log.Printf("[%s] Error storing the %s image of worker %d: %v", requestID(r.Context()), size, workerID, err)
+	}
+	return img, nil
 }
 
-func uploadWorkerImage(w http.ResponseWriter, r *http.Request) {
-	enableCORS(&w)
+// loadImage reads the data of an image from blob storage unless it is still
+// kept in the database.
+func (s *server) loadImage(ctx context.Context, img *WorkerImage) error {
+	if img.Data != nil {
+		return nil
+	}
+	data, err := s.blobs.Get(ctx, img.Key)
+	img.Data = data
+	return err
+}
+
+func (s *server) putImage(ctx context.Context, img *WorkerImage) error {
+	img.Key = blobKey(img.Data)
+	return s.blobs.Put(ctx, img.Key, img.Data, img.ContentType)
+}
+
+func (s *server) uploadWorkerImage(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditWorkers) {
+		return
+	}
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, methodNotAllowed())
 		return
 	}
-	vars := mux.Vars(r)
-	workerID := vars["id"]
-	err := r.ParseMultipartForm(5 << 20)
+	workerID, err := pathID(r)
 	if err != nil {
-		http.Error(w, "File too large", http.StatusBadRequest)
+		writeError(w, r, badRequest("Invalid worker ID"))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.upload.MaxImageBytes+1<<20)
+	err = r.ParseMultipartForm(s.upload.MaxImageBytes)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, fileTooLarge(s.upload.MaxImageBytes))
+		} else {
+			writeError(w, r, badRequest("Send the image as multipart/form-data in the field image"))
+		}
 		return
 	}
 	file, _, err := r.FormFile("image")
 	if err != nil {
-		http.Error(w, "Error retrieving file", http.StatusBadRequest)
+		writeError(w, r, badRequest("Error retrieving file"))
 		return
 	}
 	defer file.Close()
-	fileBytes, err := io.ReadAll(file)
+	fileBytes, err := io.ReadAll(io.LimitReader(file, s.upload.MaxImageBytes+1))
+	if err != nil {
+		writeError(w, r, internalError("Error reading file", err))
+		return
+	}
+	if int64(len(fileBytes)) > s.upload.MaxImageBytes {
+		writeError(w, r, fileTooLarge(s.upload.MaxImageBytes))
+		return
+	}
+	upload, apiErr := checkImage(fileBytes, s.upload)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	images, err := processImage(upload)
 	if err != nil {
-		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		writeError(w, r, internalError("Error processing image", err))
 		return
 	}
-	query := `UPDATE medical_workers SET image_data = @p1 WHERE worker_id = @p2`
-	_, err = db.Exec(query, fileBytes, workerID)
+	for _, img := range images {
+		if err := s.putImage(r.Context(), img); err != nil {
+			writeError(w, r, internalError("Error storing image", err))
+			return
+		}
+	}
+	err = s.workers.SetWorkerImage(r.Context(), workerID, images)
 	if err != nil {
-		log.Printf("Error updating image: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeError(w, r, storeError(err, "Worker"))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Image uploaded successfully"})
 }
 
-func deleteWorkerImage(w http.ResponseWriter, r *http.Request) {
-	enableCORS(&w)
+func (s *server) deleteWorkerImage(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditWorkers) {
+		return
+	}
 	if r.Method != "DELETE" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, methodNotAllowed())
 		return
 	}
-	vars := mux.Vars(r)
-	workerID := vars["id"]
-	query := `UPDATE medical_workers SET image_data = NULL WHERE worker_id = @p1`
-	_, err := db.Exec(query, workerID)
+	workerID, err := pathID(r)
 	if err != nil {
-		log.Printf("Error deleting image: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeError(w, r, badRequest("Invalid worker ID"))
+		return
+	}
+	err = s.workers.SetWorkerImage(r.Context(), workerID, nil)
+	if err != nil {
+		writeError(w, r, storeError(err, "Worker"))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Image deleted successfully"})
 }
 
-func getMedicalWorkers(w http.ResponseWriter, r *http.Request) {
-	departmentID := r.URL.Query().Get("department_id")
-	specializationID := r.URL.Query().Get("specialization_id")
-	query := `
-		SELECT 
-			worker_id, first_name, last_name, email, phone_number,
-			department_id, department_name, 
-			specialization_id, specialization_name,
-			hire_date, salary, license_number,
-			CASE WHEN image_data IS NULL THEN 0 ELSE 1 END as has_image,
-			row_version,
-			dbo.fn_GetWorkerExperience(hire_date) as experience
-		FROM vw_MedicalWorkers_Detailed
-		WHERE 1=1
-	`
-	if departmentID != "" {
-		query += " AND department_id = " + departmentID
-	}
-	if specializationID != "" {
-		query += " AND specialization_id = " + specializationID
-	}
-	query += " ORDER BY last_name, first_name"
-	rows, err := db.Query(query)
-	if err != nil {
-		log.Printf("Error querying medical workers: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode([]MedicalWorker{})
-		return
-	}
-	defer rows.Close()
-	var workers []MedicalWorker
-	for rows.Next() {
-		var mw MedicalWorker
-		var rowVersionHex string
-		err := rows.Scan(
-			&mw.WorkerID, &mw.FirstName, &mw.LastName, &mw.Email, &mw.PhoneNumber,
-			&mw.DepartmentID, &mw.DepartmentName,
-			&mw.SpecializationID, &mw.SpecializationName,
-			&mw.HireDate, &mw.Salary, &mw.LicenseNumber,
-			&mw.HasImage,
-			&rowVersionHex,
-			&mw.Experience,
-		)
-		if err != nil {
-			log.Printf("Error scanning worker: %v", err)
-			continue
-		}
-		mw.RowVersion = rowVersionHex
-		workers = append(workers, mw)
+func (s *server) getMedicalWorkers(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFilters(r.URL.Query(), workerFilters)
+	if err != nil {
+		writeError(w, r, invalidFilter(err))
+		return
+	}
+	page, err := parsePage(r.URL.Query())
+	if err != nil {
+		writeError(w, r, invalidFilter(err))
+		return
+	}
+	sess := currentSession(r.Context())
+	if err := sess.checkWorkerQuery(filters, page); err != nil {
+		writeError(w, r, invalidFilter(err))
+		return
+	}
+	result, err := s.workers.ListWorkers(r.Context(), sess.scope(filters), page)
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
 	}
-	if workers == nil {
-		workers = []MedicalWorker{}
+	if result.HasMore {
+		w.Header().Set("X-Next-Cursor", page.nextCursor(&result.Workers[len(result.Workers)-1]))
 	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(result.Total))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(workers)
-}
-
-func getMedicalWorkerByID(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	workerID := vars["id"]
-	query := `
-		SELECT 
-			worker_id, first_name, last_name, email, phone_number,
-			department_id, department_name, 
-			specialization_id, specialization_name,
-			hire_date, salary, license_number,
-			CASE WHEN image_data IS NULL THEN 0 ELSE 1 END as has_image,
-			row_version,
-			dbo.fn_GetWorkerExperience(hire_date) as experience
-		FROM vw_MedicalWorkers_Detailed
-		WHERE worker_id = @p1
-	`
-	var mw MedicalWorker
-	var rowVersionHex string
-	err := db.QueryRow(query, workerID).Scan(
-		&mw.WorkerID, &mw.FirstName, &mw.LastName, &mw.Email, &mw.PhoneNumber,
-		&mw.DepartmentID, &mw.DepartmentName,
-		&mw.SpecializationID, &mw.SpecializationName,
-		&mw.HireDate, &mw.Salary, &mw.LicenseNumber,
-		&mw.HasImage,
-		&rowVersionHex,
-		&mw.Experience,
-	)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Worker not found", http.StatusNotFound)
-			return
-		}
-		log.Printf("Error getting worker: %v", err)
-		http.Error(w, "Failed to get worker", http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(sess.workers(result.Workers))
+}
+
+func (s *server) getMedicalWorkerByID(w http.ResponseWriter, r *http.Request) {
+	workerID, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid worker ID"))
+		return
+	}
+	mw, apiErr := s.visibleWorker(r, workerID)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	etag := rowVersionETag(mw.RowVersion)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag, true) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
-	mw.RowVersion = rowVersionHex
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(mw)
+	json.NewEncoder(w).Encode(currentSession(r.Context()).worker(mw))
+}
+
+// visibleWorker loads a worker the caller may see. Workers of other
+// departments are reported as missing, not revealing that they exist.
+func (s *server) visibleWorker(r *http.Request, id int) (*MedicalWorker, *APIError) {
+	mw, err := s.workers.GetWorker(r.Context(), id)
+	if err != nil {
+		return nil, storeError(err, "Worker")
+	}
+	if !currentSession(r.Context()).seesDepartment(mw.DepartmentID) {
+		return nil, notFound("Worker")
+	}
+	return mw, nil
 }
 
-func getFacilityTypes(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT facility_type_id, type_name FROM facility_types")
+func (s *server) getFacilityTypes(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFilters(r.URL.Query(), facilityTypeFilters)
 	if err != nil {
-		log.Printf("Error querying facility_types: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeError(w, r, invalidFilter(err))
 		return
 	}
-	defer rows.Close()
-	var facilityTypes []FacilityType
-	for rows.Next() {
-		var ft FacilityType
-		err := rows.Scan(&ft.FacilityTypeID, &ft.TypeName)
-		if err != nil {
-			log.Printf("Error scanning facility type: %v", err)
-			continue
-		}
-		facilityTypes = append(facilityTypes, ft)
+	facilityTypes, err := s.refs.ListFacilityTypes(r.Context(), filters)
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(facilityTypes)
 }
 
-func getDepartmentsByFacilityType(w http.ResponseWriter, r *http.Request) {
-	facilityTypeID := r.URL.Query().Get("facility_type_id")
-	if facilityTypeID == "" {
+func (s *server) getDepartmentsByFacilityType(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("facility_type_id") == "" {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode([]Department{})
 		return
 	}
-	query := "SELECT DISTINCT department_id, department_name, facility_type_id FROM departments WHERE facility_type_id = @p1 ORDER BY department_name"
-	rows, err := db.Query(query, facilityTypeID)
+	filters, err := parseFilters(r.URL.Query(), departmentFilters)
 	if err != nil {
-		log.Printf("Error querying departments: %v", err)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode([]Department{})
+		writeError(w, r, invalidFilter(err))
 		return
 	}
-	defer rows.Close()
-	var departments []Department
-	for rows.Next() {
-		var d Department
-		err := rows.Scan(&d.DepartmentID, &d.DepartmentName, &d.FacilityTypeID)
-		if err != nil {
-			log.Printf("Error scanning department: %v", err)
-			continue
-		}
-		departments = append(departments, d)
-	}
-	if departments == nil {
-		departments = []Department{}
+	departments, err := s.departments.ListDepartments(r.Context(), currentSession(r.Context()).scope(filters))
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(departments)
 }
 
-func getSpecializations(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT specialization_id, specialization_name, category FROM specializations")
+func (s *server) getSpecializations(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFilters(r.URL.Query(), specializationFilters)
 	if err != nil {
-		log.Printf("Error querying specializations: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeError(w, r, invalidFilter(err))
 		return
 	}
-	defer rows.Close()
-	var specializations []Specialization
-	for rows.Next() {
-		var s Specialization
-		err := rows.Scan(&s.SpecializationID, &s.SpecializationName, &s.Category)
-		if err != nil {
-			log.Printf("Error scanning specialization: %v", err)
-			continue
-		}
-		specializations = append(specializations, s)
+	specializations, err := s.refs.ListSpecializations(r.Context(), filters)
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(specializations)
 }
 
-func addMedicalWorker(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func (s *server) addMedicalWorker(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditWorkers) {
 		return
 	}
-	var worker struct {
-		FirstName        string  `json:"first_name"`
-		LastName         string  `json:"last_name"`
-		Email            string  `json:"email"`
-		PhoneNumber      string  `json:"phone_number"`
-		DepartmentID     int     `json:"department_id"`
-		SpecializationID int     `json:"specialization_id"`
-		HireDate         string  `json:"hire_date"`
-		Salary           float64 `json:"salary"`
-		LicenseNumber    string  `json:"license_number"`
+	if r.Method != "POST" {
+		writeError(w, r, methodNotAllowed())
+		return
 	}
+	var worker WorkerInput
 	err := json.NewDecoder(r.Body).Decode(&worker)
 	if err != nil {
 		log.Printf("Error decoding request: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, badRequest("Invalid JSON"))
 		return
 	}
-	query := `INSERT INTO medical_workers 
-		(first_name, last_name, email, phone_number, department_id, specialization_id, hire_date, salary, license_number) 
-		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9);
-		SELECT SCOPE_IDENTITY();`
-	var newWorkerID int64
-	err = db.QueryRow(query,
-		worker.FirstName, worker.LastName, worker.Email, worker.PhoneNumber,
-		worker.DepartmentID, worker.SpecializationID, worker.HireDate, worker.Salary, worker.LicenseNumber).Scan(&newWorkerID)
+	if err := worker.validate(time.Now()); err != nil {
+		writeError(w, r, validationFailed(err))
+		return
+	}
+	newWorkerID, err := s.workers.CreateWorker(r.Context(), &worker)
 	if err != nil {
-		log.Printf("Error inserting worker: %v", err)
-		http.Error(w, "Failed to insert worker", http.StatusInternalServerError)
+		writeError(w, r, workerWriteError(err))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -400,144 +458,326 @@ func addMedicalWorker(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func updateMedicalWorker(w http.ResponseWriter, r *http.Request) {
+func (s *server) updateMedicalWorker(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditWorkers) {
+		return
+	}
 	if r.Method != "PUT" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, methodNotAllowed())
+		return
+	}
+	workerID, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid worker ID"))
 		return
 	}
-	vars := mux.Vars(r)
-	workerID := vars["id"]
 	var updateData struct {
-		FirstName        string  `json:"first_name"`
-		LastName         string  `json:"last_name"`
-		Email            string  `json:"email"`
-		PhoneNumber      string  `json:"phone_number"`
-		DepartmentID     int     `json:"department_id"`
-		SpecializationID int     `json:"specialization_id"`
-		HireDate         string  `json:"hire_date"`
-		Salary           float64 `json:"salary"`
-		LicenseNumber    string  `json:"license_number"`
-		RowVersion       string  `json:"row_version"`
-	}
-	err := json.NewDecoder(r.Body).Decode(&updateData)
+		WorkerInput
+		RowVersion string `json:"row_version"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&updateData)
 	if err != nil {
 		log.Printf("Error decoding update request: %v", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, badRequest("Invalid JSON"))
 		return
 	}
-	rowVersionBytes, err := hexToVarbinary(updateData.RowVersion)
-	if err != nil {
-		log.Printf("Error converting row_version: %v", err)
-		http.Error(w, "Invalid row_version format", http.StatusBadRequest)
+	if err := updateData.validate(time.Now()); err != nil {
+		writeError(w, r, validationFailed(err))
+		return
+	}
+	ifMatch, apiErr := s.workerIfMatch(r, workerID)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
 		return
 	}
-	query := `UPDATE medical_workers 
-		SET first_name = @p1, 
-			last_name = @p2, 
-			email = @p3, 
-			phone_number = @p4, 
-			department_id = @p5, 
-			specialization_id = @p6, 
-			hire_date = @p7, 
-			salary = @p8, 
-			license_number = @p9
-		WHERE worker_id = @p10 
-		AND row_version = @p11`
-	result, err := db.Exec(query,
-		updateData.FirstName, updateData.LastName, updateData.Email, updateData.PhoneNumber,
-		updateData.DepartmentID, updateData.SpecializationID, updateData.HireDate,
-		updateData.Salary, updateData.LicenseNumber, workerID, rowVersionBytes)
+	if ifMatch != "" {
+		updateData.RowVersion = ifMatch
+	}
+	if updateData.RowVersion == "" {
+		writeError(w, r, validationFailed(FieldErrors{{Field: "row_version", Message: "is required without an If-Match header"}}))
+		return
+	}
+	err = s.workers.UpdateWorker(r.Context(), workerID, &updateData.WorkerInput, updateData.RowVersion)
 	if err != nil {
-		log.Printf("Error updating worker: %v", err)
-		http.Error(w, "Failed to update worker", http.StatusInternalServerError)
+		writeError(w, r, s.workerConflict(r, versionedWriteError(r, err), workerID, &updateData.WorkerInput, workerFields))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Medical worker updated successfully"})
+}
+
+// patchMedicalWorker applies a JSON merge patch to a worker. The patch must
+// carry the row_version the client last saw, or the request an If-Match
+// header.
+func (s *server) patchMedicalWorker(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditWorkers) {
 		return
 	}
-	rowsAffected, err := result.RowsAffected()
+	workerID, err := pathID(r)
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Failed to update worker", http.StatusInternalServerError)
+		writeError(w, r, badRequest("Invalid worker ID"))
 		return
 	}
-	if rowsAffected == 0 {
-		var exists bool
-		err = db.QueryRow("SELECT 1 FROM medical_workers WHERE worker_id = @p1", workerID).Scan(&exists)
-		if err == sql.ErrNoRows || !exists {
-			http.Error(w, "Worker not found", http.StatusNotFound)
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		if mt, _, _ := mime.ParseMediaType(ct); mt != "application/merge-patch+json" && mt != "application/json" {
+			writeError(w, r, unsupportedMediaType("Send the patch as application/merge-patch+json"))
 			return
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error":   "CONCURRENCY_CONFLICT",
-			"message": "This record has been modified by another user since you loaded it. Please reload and try again.",
-		})
+	}
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil || patch == nil {
+		writeError(w, r, badRequest("The merge patch must be a JSON object"))
+		return
+	}
+	var rowVersion string
+	if raw, ok := patch["row_version"]; ok {
+		if err := json.Unmarshal(raw, &rowVersion); err != nil {
+			writeError(w, r, validationFailed(FieldErrors{{Field: "row_version", Message: "must be a string"}}))
+			return
+		}
+		delete(patch, "row_version")
+	}
+	ifMatch, apiErr := s.workerIfMatch(r, workerID)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
 		return
 	}
+	if ifMatch != "" {
+		rowVersion = ifMatch
+	}
+	if rowVersion == "" {
+		writeError(w, r, validationFailed(FieldErrors{{Field: "row_version", Message: "is required without an If-Match header"}}))
+		return
+	}
+	current, err := s.workers.GetWorker(r.Context(), workerID)
+	if err != nil {
+		writeError(w, r, storeError(err, "Worker"))
+		return
+	}
+	merged, fields, err := mergeWorkerPatch(current, patch)
+	if err == nil {
+		err = merged.validatePatched(time.Now(), fields)
+	}
+	if err != nil {
+		writeError(w, r, validationFailed(err))
+		return
+	}
+	if len(fields) == 0 {
+		// Nothing to write, but a stale version is reported all the same.
+		if !strings.EqualFold(rowVersion, current.RowVersion) {
+			err = ErrConflict
+		}
+	} else {
+		err = s.workers.PatchWorker(r.Context(), workerID, merged.columnValues(fields), rowVersion)
+		if err == nil {
+			current, err = s.workers.GetWorker(r.Context(), workerID)
+		}
+	}
+	if err != nil {
+		writeError(w, r, s.workerConflict(r, versionedWriteError(r, err), workerID, merged, fields))
+		return
+	}
+	w.Header().Set("ETag", rowVersionETag(current.RowVersion))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Medical worker updated successfully"})
+	json.NewEncoder(w).Encode(current)
 }
 
-func deleteMedicalWorker(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "DELETE" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func (s *server) getMedicalWorkerHistory(w http.ResponseWriter, r *http.Request) {
+	workerID, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid worker ID"))
 		return
 	}
-	vars := mux.Vars(r)
-	workerID := vars["id"]
-	_, err := db.Exec("DELETE FROM medical_workers WHERE worker_id = @p1", workerID)
+	versions, err := s.workers.WorkerHistory(r.Context(), workerID)
+	if err == nil {
+		if versions = currentSession(r.Context()).history(versions); len(versions) == 0 {
+			err = ErrNotFound
+		}
+	}
 	if err != nil {
-		log.Printf("Error deleting worker: %v", err)
-		http.Error(w, "Failed to delete worker", http.StatusInternalServerError)
+		writeError(w, r, storeError(err, "Worker"))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Medical worker deleted successfully"})
+	json.NewEncoder(w).Encode(versions)
 }
 
-func getAllDepartments(w http.ResponseWriter, r *http.Request) {
-	rows, err := db.Query("SELECT department_id, department_name, department_head, location, phone_number, facility_type_id, created_date FROM departments ORDER BY department_name")
+func (s *server) restoreMedicalWorker(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditWorkers) {
+		return
+	}
+	workerID, err := pathID(r)
 	if err != nil {
-		log.Printf("Error querying all departments: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeError(w, r, badRequest("Invalid worker ID"))
 		return
 	}
-	defer rows.Close()
-	var departments []Department
-	for rows.Next() {
-		var d Department
-		var departmentHead, location, phoneNumber, createdDate sql.NullString
-		err := rows.Scan(&d.DepartmentID, &d.DepartmentName, &departmentHead, &location, &phoneNumber, &d.FacilityTypeID, &createdDate)
-		if err != nil {
-			log.Printf("Error scanning department: %v", err)
-			continue
-		}
-		if departmentHead.Valid {
-			d.DepartmentHead = &departmentHead.String
-		}
-		if location.Valid {
-			d.Location = &location.String
-		}
-		if phoneNumber.Valid {
-			d.PhoneNumber = &phoneNumber.String
-		}
-		if createdDate.Valid {
-			d.CreatedDate = &createdDate.String
+	err = s.workers.RestoreWorker(r.Context(), workerID)
+	var mw *MedicalWorker
+	if err == nil {
+		mw, err = s.workers.GetWorker(r.Context(), workerID)
+	}
+	if err != nil {
+		writeError(w, r, storeError(err, "Worker"))
+		return
+	}
+	w.Header().Set("ETag", rowVersionETag(mw.RowVersion))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(mw)
+}
+
+func (s *server) deleteMedicalWorker(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditWorkers) {
+		return
+	}
+	if r.Method != "DELETE" {
+		writeError(w, r, methodNotAllowed())
+		return
+	}
+	workerID, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid worker ID"))
+		return
+	}
+	ifMatch, apiErr := s.workerIfMatch(r, workerID)
+	if apiErr != nil {
+		writeError(w, r, apiErr)
+		return
+	}
+	err = s.workers.DeleteWorker(r.Context(), workerID, ifMatch)
+	if err != nil {
+		writeError(w, r, versionedWriteError(r, err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Medical worker archived successfully"})
+}
+
+// workerWriteError reports a failed worker insert or update.
+func workerWriteError(err error) *APIError {
+	e := storeError(err, "Worker")
+	switch err {
+	case ErrDuplicate:
+		e.Message = "Another worker already has this email or license number."
+	case ErrInvalidReference:
+		e.Message = "The department or specialization does not exist."
+	}
+	return e
+}
+
+// workerConflict adds the stored worker, and how it differs from the
+// submitted fields, to a concurrency conflict so that the client can merge
+// the changes instead of reloading. Other errors are returned as they are.
+func (s *server) workerConflict(r *http.Request, e *APIError, id int, submitted *WorkerInput, fields []string) *APIError {
+	if e.Code != "CONCURRENCY_CONFLICT" {
+		return e
+	}
+	current, err := s.workers.GetWorker(r.Context(), id)
+	if err != nil {
+		return e
+	}
+	stored := current.input()
+	mine, theirs := submitted.columnValues(fields), stored.columnValues(fields)
+	for _, f := range fields {
+		if mine[f] != theirs[f] {
+			e.Diff = append(e.Diff, FieldDiff{Field: f, Submitted: mine[f], Current: theirs[f]})
 		}
-		departments = append(departments, d)
+	}
+	e.Current = current
+	e.RowVersion = current.RowVersion
+	e.Message = "This record has been modified by another user since you loaded it. Review the differences and save again."
+	return e
+}
+
+func (s *server) getAllDepartments(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFilters(r.URL.Query(), departmentFilters)
+	if err != nil {
+		writeError(w, r, invalidFilter(err))
+		return
+	}
+	departments, err := s.departments.ListDepartments(r.Context(), currentSession(r.Context()).scope(filters))
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(departments)
 }
 
-func enableCORS(w *http.ResponseWriter) {
-	(*w).Header().Set("Access-Control-Allow-Origin", "*")
-	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Content-Type")
+func (s *server) enableCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	for _, allowed := range s.allowedOrigins {
+		if allowed == "*" {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			break
+		}
+		if origin != "" && allowed == origin {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Add("Vary", "Origin")
+			break
+		}
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Request-ID, X-CSRF-Token, If-Match, If-None-Match")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Next-Cursor, X-Request-ID, ETag")
+}
+
+// apiHandler serves an API endpoint that needs a logged in user.
+// routes maps the API endpoints and the static pages in staticDir.
+func (s *server) routes(staticDir string) *mux.Router {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/login", s.publicAPIHandler(s.login)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/logout", s.apiHandler(s.logout)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/session", s.apiHandler(s.getSession)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/tokens", s.apiHandler(s.getAPITokens)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/tokens", s.apiHandler(s.createAPIToken)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/tokens/{id}", s.apiHandler(s.revokeAPIToken)).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/facility-types", s.apiHandler(s.getFacilityTypes)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/facility-types", s.apiHandler(s.addFacilityType)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/facility-types/{id}", s.apiHandler(s.getFacilityType)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/facility-types/{id}", s.apiHandler(s.updateFacilityType)).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/facility-types/{id}", s.apiHandler(s.deleteFacilityType)).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/departments", s.apiHandler(s.getDepartmentsByFacilityType)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/all-departments", s.apiHandler(s.getAllDepartments)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/specializations", s.apiHandler(s.getSpecializations)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/specializations", s.apiHandler(s.addSpecialization)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/specializations/{id}", s.apiHandler(s.getSpecialization)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/specializations/{id}", s.apiHandler(s.updateSpecialization)).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/specializations/{id}", s.apiHandler(s.deleteSpecialization)).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/medical-workers", s.apiHandler(s.getMedicalWorkers)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/medical-workers", s.apiHandler(s.addMedicalWorker)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/medical-workers/{id}", s.apiHandler(s.deleteMedicalWorker)).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/medical-workers/{id}", s.apiHandler(s.getMedicalWorkerByID)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/medical-workers/{id}", s.apiHandler(s.updateMedicalWorker)).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/medical-workers/{id}", s.apiHandler(s.patchMedicalWorker)).Methods("PATCH", "OPTIONS")
+	router.HandleFunc("/api/medical-workers/{id}/history", s.apiHandler(s.getMedicalWorkerHistory)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/medical-workers/{id}/restore", s.apiHandler(s.restoreMedicalWorker)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/departments", s.apiHandler(s.addDepartment)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/departments/{id}", s.apiHandler(s.updateDepartment)).Methods("PUT", "OPTIONS")
+	router.HandleFunc("/api/departments/{id}", s.apiHandler(s.deleteDepartment)).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/departments/{id}/statistics", s.apiHandler(s.getDepartmentStatisticsByID)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/department-statistics", s.apiHandler(s.getDepartmentStatistics)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/department-details/{id}", s.apiHandler(s.getDepartmentDetails)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/medical-workers/{id}/image", s.apiHandler(s.getWorkerImage)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/medical-workers/{id}/image", s.apiHandler(s.uploadWorkerImage)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/medical-workers/{id}/image", s.apiHandler(s.deleteWorkerImage)).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/api/audit", s.apiHandler(s.getAuditLog)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/download-report", s.apiHandler(s.downloadExcelReport)).Methods("GET", "OPTIONS")
+	router.PathPrefix("/api/").HandlerFunc(s.apiHandler(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, notFound("API endpoint"))
+	}))
+	router.PathPrefix("/").Handler(s.pageHandler(http.FileServer(http.Dir(staticDir))))
+	return router
+}
+
+func (s *server) apiHandler(next http.HandlerFunc) http.HandlerFunc {
+	return s.publicAPIHandler(s.requireSession(next))
 }
 
-func apiHandler(next http.HandlerFunc) http.HandlerFunc {
+func (s *server) publicAPIHandler(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		enableCORS(&w)
+		r = withRequestID(w, r)
+		s.enableCORS(w, r)
 		if r.Method == "OPTIONS" {
 			return
 		}
@@ -545,60 +785,26 @@ func apiHandler(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func downloadExcelReport(w http.ResponseWriter, r *http.Request) {
-	enableCORS(&w)
+func (s *server) downloadExcelReport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "OPTIONS" && r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, methodNotAllowed())
 		return
 	}
 	file := xlsx.NewFile()
-	tables := []struct {
-		name  string
-		query string
-	}{
-		{
-			name:  "Facility Types",
-			query: "SELECT facility_type_id, type_name, description, typical_bed_capacity, accreditation_required FROM facility_types ORDER BY facility_type_id",
-		},
-		{
-			name:  "Departments",
-			query: "SELECT department_id, department_name, department_head, location, phone_number, facility_type_id, created_date FROM departments ORDER BY department_id",
-		},
-		{
-			name:  "Specializations",
-			query: "SELECT specialization_id, specialization_name, description, category, required_years_training, certification_required FROM specializations ORDER BY specialization_id",
-		},
-		{
-			name:  "Medical Workers",
-			query: "SELECT worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date, salary, license_number, image_data, created_date, row_version FROM medical_workers ORDER BY worker_id",
-		},
-		{
-			name:  "Medical Workers View",
-			query: "SELECT worker_id, first_name, last_name, email, phone_number, department_id, department_name, specialization_id, specialization_name, hire_date, salary, license_number, image_data, row_version FROM vw_MedicalWorkers_Detailed ORDER BY worker_id",
-		},
-		{
-			name:  "Department Statistics",
-			query: "EXEC dbo.sp_GetDepartmentStatistics",
-		},
-	}
-	for _, table := range tables {
-		rows, err := db.Query(table.query)
-		if err != nil {
-			log.Printf("Error querying %s: %v", table.name, err)
-			continue
-		}
-		sheet, err := file.AddSheet(table.name)
-		if err != nil {
-			log.Printf("Error creating sheet for %s: %v", table.name, err)
-			rows.Close()
-			continue
-		}
-		cols, err := rows.Columns()
+	sheets, err := s.reports.ReportSheets(r.Context())
+	if err != nil {
+		writeError(w, r, internalError("Failed to generate report", err))
+		return
+	}
+	sess := currentSession(r.Context())
+	for _, table := range sheets {
+		table = sess.reportSheet(table)
+		sheet, err := file.AddSheet(table.Name)
 		if err != nil {
-			log.Printf("Error getting columns for %s: %v", table.name, err)
-			rows.Close()
+			log.Printf("Error creating sheet for %s: %v", table.Name, err)
 			continue
 		}
+		cols := table.Columns
 		headerRow := sheet.AddRow()
 		for _, col := range cols {
 			cell := headerRow.AddCell()
@@ -607,36 +813,19 @@ func downloadExcelReport(w http.ResponseWriter, r *http.Request) {
 			cell.GetStyle().Fill.PatternType = "solid"
 			cell.GetStyle().Fill.FgColor = "FFE0E0E0"
 		}
-		colTypes, err := rows.ColumnTypes()
-		if err != nil {
-			log.Printf("Error getting column types for %s: %v", table.name, err)
-			rows.Close()
-			continue
-		}
-		rowCount := 0
-		for rows.Next() {
-			values := make([]interface{}, len(cols))
-			valuePtrs := make([]interface{}, len(cols))
-			for i := range values {
-				valuePtrs[i] = &values[i]
-			}
-			err := rows.Scan(valuePtrs...)
-			if err != nil {
-				log.Printf("Error scanning row for %s: %v", table.name, err)
-				continue
-			}
+		for _, values := range table.Rows {
 			row := sheet.AddRow()
 			for i, val := range values {
 				cell := row.AddCell()
 				colName := cols[i]
-				colType := colTypes[i].DatabaseTypeName()
+				colType := table.Types[i]
 				if val == nil {
 					cell.Value = ""
 					continue
 				}
 				switch v := val.(type) {
 				case []byte:
-					if strings.Contains(colType, "BINARY") || strings.Contains(colType, "ROWVERSION") {
+					if strings.Contains(colType, "BINARY") || strings.Contains(colType, "ROWVERSION") || colType == "BLOB" {
 						if len(v) > 0 {
 							if colName == "row_version" {
 								cell.Value = hex.EncodeToString(v)
@@ -669,13 +858,11 @@ func downloadExcelReport(w http.ResponseWriter, r *http.Request) {
 					cell.SetString(fmt.Sprintf("%v", v))
 				}
 			}
-			rowCount++
 		}
-		rows.Close()
 		for i := 0; i < len(cols); i++ {
 			sheet.Col(i).Width = 15
 		}
-		if table.name == "Medical Workers" || table.name == "Medical Workers View" {
+		if table.Name == "Medical Workers" || table.Name == "Medical Workers View" {
 			sheet.Col(0).Width = 8
 			sheet.Col(1).Width = 12
 			sheet.Col(2).Width = 12
@@ -684,7 +871,7 @@ func downloadExcelReport(w http.ResponseWriter, r *http.Request) {
 			sheet.Col(9).Width = 12
 			sheet.Col(10).Width = 15
 		}
-		if table.name == "Department Statistics" {
+		if table.Name == "Department Statistics" {
 			sheet.Col(0).Width = 8
 			sheet.Col(1).Width = 20
 			sheet.Col(2).Width = 15
@@ -710,118 +897,347 @@ func downloadExcelReport(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 	w.Header().Set("Content-Transfer-Encoding", "binary")
 	w.Header().Set("Cache-Control", "no-cache")
-	err := file.Write(w)
+	err = file.Write(w)
 	if err != nil {
-		log.Printf("Error writing Excel file: %v", err)
-		http.Error(w, "Failed to generate report", http.StatusInternalServerError)
+		writeError(w, r, internalError("Failed to generate report", err))
 		return
 	}
 }
 
-func deleteDepartment(w http.ResponseWriter, r *http.Request) {
-	enableCORS(&w)
+// deleteDepartment removes a department. One that still has workers is
+// refused with 409 unless reassign_to names a department to move them to;
+// dry_run=true only reports what would happen.
+func (s *server) deleteDepartment(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditDepartments) {
+		return
+	}
 	if r.Method != "DELETE" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, methodNotAllowed())
 		return
 	}
-	vars := mux.Vars(r)
-	departmentID := vars["id"]
-	var departmentName string
-	err := db.QueryRow("SELECT department_name FROM departments WHERE department_id = @p1", departmentID).Scan(&departmentName)
+	departmentID, err := pathID(r)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Department not found", http.StatusNotFound)
-			return
-		}
-		log.Printf("Error checking department: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeError(w, r, badRequest("Invalid department ID"))
 		return
 	}
-	query := `DELETE FROM departments WHERE department_id = @p1`
-	result, err := db.Exec(query, departmentID)
+	opts, err := parseFilters(r.URL.Query(), departmentDeleteParams)
 	if err != nil {
-		if strings.Contains(err.Error(), "FOREIGN KEY constraint") {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusConflict)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error":   "CONSTRAINT_ERROR",
-				"message": "Cannot delete department because it has related medical workers. Delete the workers first.",
-			})
-			return
+		writeError(w, r, invalidFilter(err))
+		return
+	}
+	reassignTo, _ := opts["reassign_to"].(int)
+	dryRun, _ := opts["dry_run"].(bool)
+	if reassignTo == departmentID {
+		writeError(w, r, validationFailed(FieldErrors{{Field: "reassign_to", Message: "must be another department"}}))
+		return
+	}
+	dept, err := s.departments.GetDepartment(r.Context(), departmentID)
+	if err != nil {
+		writeError(w, r, storeError(err, "Department"))
+		return
+	}
+	workers, err := s.departments.DeleteDepartment(r.Context(), departmentID, reassignTo, dryRun)
+	if err != nil {
+		e := storeError(err, "Department")
+		switch err {
+		case ErrInUse:
+			e.Message = "Cannot delete department because it has medical workers, archived ones included. Move them to another department with reassign_to."
+			e.References = map[string]int{"medical_workers": len(workers)}
+		case ErrInvalidReference:
+			e.Message = "The department to reassign the workers to does not exist."
+			e.Fields = FieldErrors{{Field: "reassign_to", Message: "does not exist"}}
 		}
-		log.Printf("Error deleting department: %v", err)
-		http.Error(w, "Failed to delete department", http.StatusInternalServerError)
+		writeError(w, r, e)
 		return
 	}
-	rowsAffected, err := result.RowsAffected()
+	resp := map[string]interface{}{
+		"department_id":      departmentID,
+		"dry_run":            dryRun,
+		"workers":            workers,
+		"workers_reassigned": len(workers),
+	}
+	if reassignTo != 0 {
+		resp["reassigned_to"] = reassignTo
+	}
+	resp["message"] = fmt.Sprintf("Department '%s' deleted successfully", dept.DepartmentName)
+	if dryRun {
+		resp["message"] = fmt.Sprintf("Department '%s' can be deleted; nothing was changed", dept.DepartmentName)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *server) addDepartment(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditDepartments) {
+		return
+	}
+	var dept DepartmentInput
+	err := json.NewDecoder(r.Body).Decode(&dept)
 	if err != nil {
-		log.Printf("Error getting rows affected: %v", err)
-		http.Error(w, "Failed to delete department", http.StatusInternalServerError)
+		log.Printf("Error decoding request: %v", err)
+		writeError(w, r, badRequest("Invalid JSON"))
+		return
+	}
+	if err := dept.validate(); err != nil {
+		writeError(w, r, validationFailed(err))
 		return
 	}
-	if rowsAffected == 0 {
-		http.Error(w, "Department not found", http.StatusNotFound)
+	newDepartmentID, err := s.departments.CreateDepartment(r.Context(), &dept)
+	if err != nil {
+		writeError(w, r, departmentWriteError(err, &dept))
 		return
 	}
-	var workersDeleted int
-	db.QueryRow("SELECT COUNT(*) FROM medical_workers WHERE department_id = @p1", departmentID).Scan(&workersDeleted)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":         fmt.Sprintf("Department '%s' deleted successfully", departmentName),
-		"workers_deleted": workersDeleted,
-		"department_id":   departmentID,
+		"message":       "Department added successfully",
+		"department_id": newDepartmentID,
 	})
 }
 
-func getDepartmentDetails(w http.ResponseWriter, r *http.Request) {
-	enableCORS(&w)
+func (s *server) updateDepartment(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditDepartments) {
+		return
+	}
+	departmentID, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid department ID"))
+		return
+	}
+	var updateData struct {
+		DepartmentInput
+		RowVersion string `json:"row_version"`
+	}
+	err = json.NewDecoder(r.Body).Decode(&updateData)
+	if err != nil {
+		log.Printf("Error decoding update request: %v", err)
+		writeError(w, r, badRequest("Invalid JSON"))
+		return
+	}
+	if err := updateData.validate(); err != nil {
+		writeError(w, r, validationFailed(err))
+		return
+	}
+	if updateData.RowVersion == "" {
+		writeError(w, r, validationFailed(FieldErrors{{Field: "row_version", Message: "is required"}}))
+		return
+	}
+	err = s.departments.UpdateDepartment(r.Context(), departmentID, &updateData.DepartmentInput, updateData.RowVersion)
+	if err != nil {
+		writeError(w, r, departmentWriteError(err, &updateData.DepartmentInput))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Department updated successfully"})
+}
+
+// departmentWriteError reports a failed department insert or update.
+func departmentWriteError(err error, dept *DepartmentInput) *APIError {
+	e := storeError(err, "Department")
+	switch err {
+	case ErrDuplicate:
+		e.Message = fmt.Sprintf("A department named '%s' already exists.", dept.DepartmentName)
+		e.Fields = FieldErrors{{Field: "department_name", Message: "is already taken"}}
+	case ErrInvalidReference:
+		e.Fields = FieldErrors{{Field: "facility_type_id", Message: "facility type does not exist"}}
+	}
+	return e
+}
+
+func (s *server) getDepartmentStatistics(w http.ResponseWriter, r *http.Request) {
+	filters, err := parseFilters(r.URL.Query(), departmentStatFilters)
+	if err != nil {
+		writeError(w, r, invalidFilter(err))
+		return
+	}
+	stats, err := s.reports.DepartmentStatistics(r.Context(), filters)
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(currentSession(r.Context()).departmentStats(stats))
+}
+
+func (s *server) getDepartmentStatisticsByID(w http.ResponseWriter, r *http.Request) {
+	departmentID, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid department ID"))
+		return
+	}
+	stats, err := s.reports.DepartmentStatistics(r.Context(), Filters{"department_id": departmentID})
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
+	}
+	stats = currentSession(r.Context()).departmentStats(stats)
+	if len(stats) == 0 {
+		writeError(w, r, notFound("Department"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats[0])
+}
+
+func (s *server) getDepartmentDetails(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" && r.Method != "OPTIONS" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, r, methodNotAllowed())
 		return
 	}
-	vars := mux.Vars(r)
-	departmentID := vars["id"]
-	query := `SELECT department_id, department_name, department_head, location, phone_number, facility_type_id, created_date FROM departments WHERE department_id = @p1`
-	var dept Department
-	err := db.QueryRow(query, departmentID).Scan(
-		&dept.DepartmentID, &dept.DepartmentName, &dept.DepartmentHead, &dept.Location,
-		&dept.PhoneNumber, &dept.FacilityTypeID, &dept.CreatedDate,
-	)
+	departmentID, err := pathID(r)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Department not found", http.StatusNotFound)
-			return
-		}
-		log.Printf("Error getting department details: %v", err)
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeError(w, r, badRequest("Invalid department ID"))
+		return
+	}
+	if !currentSession(r.Context()).seesDepartment(departmentID) {
+		writeError(w, r, notFound("Department"))
+		return
+	}
+	dept, err := s.departments.GetDepartment(r.Context(), departmentID)
+	if err != nil {
+		writeError(w, r, storeError(err, "Department"))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(dept)
 }
 
+// retentionActor is the audit log author of purges.
+const retentionActor = "system:retention"
+
+// purgeArchivedWorkers removes workers archived longer than the retention
+// period, at startup and then every purge interval, until ctx is done.
+func purgeArchivedWorkers(ctx context.Context, store WorkerStore, cfg ArchiveConfig) {
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := store.PurgeWorkers(ctx, time.Now().Add(-cfg.Retention))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error purging archived workers: %v", err)
+		} else if len(purged) > 0 {
+			log.Printf("Purged %d archived workers", len(purged))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	initDB()
-	defer db.Close()
-	router := mux.NewRouter()
-	router.HandleFunc("/api/facility-types", apiHandler(getFacilityTypes)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/departments", apiHandler(getDepartmentsByFacilityType)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/all-departments", apiHandler(getAllDepartments)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/specializations", apiHandler(getSpecializations)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/medical-workers", apiHandler(getMedicalWorkers)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/medical-workers", apiHandler(addMedicalWorker)).Methods("POST", "OPTIONS")
-	router.HandleFunc("/api/medical-workers/{id}", apiHandler(deleteMedicalWorker)).Methods("DELETE", "OPTIONS")
-	router.HandleFunc("/api/medical-workers/{id}", apiHandler(getMedicalWorkerByID)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/medical-workers/{id}", apiHandler(updateMedicalWorker)).Methods("PUT", "OPTIONS")
-	router.HandleFunc("/api/departments/{id}", apiHandler(deleteDepartment)).Methods("DELETE", "OPTIONS")
-	router.HandleFunc("/api/department-details/{id}", apiHandler(getDepartmentDetails)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/medical-workers/{id}/image", apiHandler(getWorkerImage)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/api/medical-workers/{id}/image", apiHandler(uploadWorkerImage)).Methods("POST", "OPTIONS")
-	router.HandleFunc("/api/medical-workers/{id}/image", apiHandler(deleteWorkerImage)).Methods("DELETE", "OPTIONS")
-	router.HandleFunc("/api/download-report", apiHandler(downloadExcelReport)).Methods("GET", "OPTIONS")
-	router.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
-	fmt.Println("Server starting on :8080")
-	fmt.Println("Add workers page: http://localhost:8080")
-	fmt.Println("View workers page: http://localhost:8080/view.html")
-	log.Fatal(http.ListenAndServe(":8080", router))
+	cfg, printConfig, err := loadConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		log.Fatal("Configuration error: ", err)
+	}
+	if printConfig {
+		fmt.Print(cfg.Redacted())
+		return
+	}
+	var store *sqlStore
+	switch cfg.Database.Driver {
+	case "mssql":
+		db := initDB(cfg.Database)
+		defer db.Close()
+		store = newMSSQLStore(db)
+	case "sqlite":
+		db, err := openSQLite(cfg.Database.DSN)
+		if err != nil {
+			log.Fatal("Error opening SQLite database: ", err)
+		}
+		defer db.Close()
+		store = newSQLiteStore(db)
+		fmt.Println("Using SQLite database", cfg.Database.DSN)
+	}
+	migrations, err := newMigrator(store, cfg.Database.Driver)
+	if err != nil {
+		log.Fatal("Error loading migrations: ", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			err = migrateCommand(ctx, migrations, args[1:])
+		case "users":
+			if err = migrations.check(ctx); err == nil {
+				err = usersCommand(ctx, store, args[1:])
+			}
+		case "images":
+			var blobs BlobStore
+			if err = migrations.check(ctx); err == nil {
+				if blobs, err = openBlobStore(cfg.Blobs); err == nil {
+					err = imagesCommand(ctx, store, blobs, args[1:])
+				}
+			}
+		default:
+			log.Fatalf("Unknown command %q", args[0])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if cfg.Database.AutoMigrate {
+		done, err := migrations.up(ctx)
+		if err != nil {
+			log.Fatal("Error applying migrations: ", err)
+		}
+		for _, mig := range done {
+			fmt.Printf("Applied migration %04d_%s\n", mig.version, mig.name)
+		}
+	}
+	if err := migrations.check(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.Auth.InitialAdminPassword != "" {
+		if err := createInitialAdmin(ctx, store, cfg.Auth.InitialAdminPassword); err != nil {
+			log.Fatal("Error creating the admin user: ", err)
+		}
+	}
+	blobs, err := openBlobStore(cfg.Blobs)
+	if err != nil {
+		log.Fatal("Error opening blob storage: ", err)
+	}
+	audited := newAuditedStore(store, store, store, store, store)
+	if cfg.Archive.Retention > 0 {
+		go purgeArchivedWorkers(withActor(ctx, retentionActor), audited, cfg.Archive)
+	}
+	go collectBlobsPeriodically(ctx, store, blobs)
+	srv := &server{
+		workers:        audited,
+		departments:    audited,
+		refs:           audited,
+		reports:        store,
+		audit:          store,
+		users:          store,
+		tokens:         store,
+		blobs:          blobs,
+		auth:           cfg.Auth,
+		upload:         cfg.Upload,
+		allowedOrigins: cfg.CORS.AllowedOrigins,
+	}
+	router := srv.routes(cfg.StaticDir)
+	fmt.Println("Server starting on", cfg.Listen)
+	fmt.Println("Add workers page: http://localhost" + cfg.Listen)
+	fmt.Println("View workers page: http://localhost" + cfg.Listen + "/view.html")
+	// On SIGINT or SIGTERM the background jobs stop and requests in flight
+	// are given time to finish.
+	httpServer := &http.Server{Addr: cfg.Listen, Handler: router}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down: %v", err)
+		}
+	}()
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+	log.Println("Server stopped")
 }
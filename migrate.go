@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations live in migrations/<driver>/NNNN_name.up.sql with a matching
+// NNNN_name.down.sql. SQL Server files may hold several batches separated by
+// GO lines.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+type migrationStatus struct {
+	migration
+	appliedAt string
+}
+
+var (
+	migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	batchSeparator    = regexp.MustCompile(`(?im)^\s*GO\s*$`)
+)
+
+// loadMigrations reads the migrations of one driver, ordered by version.
+func loadMigrations(driver string) ([]migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, e := range entries {
+		m := migrationFileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected file %s in %s", e.Name(), dir)
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := fs.ReadFile(migrationFiles, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &migration{version: version, name: m[2]}
+			byVersion[version] = mig
+		} else if mig.name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(data)
+		} else {
+			mig.down = string(data)
+		}
+	}
+	migrations := make([]migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", mig.version, mig.name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
+
+type migrator struct {
+	s          *sqlStore
+	migrations []migration
+}
+
+func newMigrator(s *sqlStore, driver string) (*migrator, error) {
+	migrations, err := loadMigrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{s: s, migrations: migrations}, nil
+}
+
+// applied returns the applied_at time of every applied version.
+func (m *migrator) applied(ctx context.Context) (map[int]string, error) {
+	if _, err := m.s.exec(ctx, m.s.d.migrationsTable()); err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	rows, err := m.s.query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]string{}
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func (m *migrator) status(ctx context.Context) ([]migrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]migrationStatus, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i] = migrationStatus{migration: mig, appliedAt: applied[mig.version]}
+	}
+	return statuses, nil
+}
+
+// check reports an error unless every known migration, and nothing else, has
+// been applied.
+func (m *migrator) check(ctx context.Context) error {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	known := map[int]bool{}
+	for _, mig := range m.migrations {
+		known[mig.version] = true
+		if _, ok := applied[mig.version]; !ok {
+			pending = append(pending, fmt.Sprintf("%04d_%s", mig.version, mig.name))
+		}
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("database has migration %04d which this build does not know; it was migrated by a newer version", version)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind, pending migrations: %s; run \"migrate up\"", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// up applies every pending migration in order and returns the applied ones.
+func (m *migrator) up(ctx context.Context) ([]migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.version]; ok {
+			continue
+		}
+		if err := m.run(ctx, mig.up, "INSERT INTO schema_migrations (version, name) VALUES (@p1, @p2)", mig.version, mig.name); err != nil {
+			return done, fmt.Errorf("migration %04d_%s: %w", mig.version, mig.name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// down reverts the last n applied migrations, newest first.
+func (m *migrator) down(ctx context.Context, n int) ([]migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.version]; !ok {
+			continue
+		}
+		if err := m.run(ctx, mig.down, "DELETE FROM schema_migrations WHERE version = @p1", mig.version); err != nil {
+			return done, fmt.Errorf("reverting %04d_%s: %w", mig.version, mig.name, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// run executes a migration script and records it in one transaction. Where
+// the dialect asks for it, foreign keys are not enforced while the script
+// runs but checked before the commit.
+func (m *migrator) run(ctx context.Context, script, record string, args ...interface{}) error {
+	conn, err := m.s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	off, on, check := m.s.d.migrationForeignKeys()
+	if off != "" {
+		if _, err := conn.ExecContext(ctx, off); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), on)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, batch := range batchSeparator.Split(script, -1) {
+		if strings.TrimSpace(batch) == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, batch); err != nil {
+			return err
+		}
+	}
+	if check != "" {
+		rows, err := tx.QueryContext(ctx, check)
+		if err != nil {
+			return err
+		}
+		broken := rows.Next()
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		if broken {
+			return fmt.Errorf("the migration leaves rows with broken foreign keys")
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, m.s.args(args...)...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// migrateCommand runs "migrate up", "migrate down [n]" or "migrate status".
+func migrateCommand(ctx context.Context, m *migrator, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up | down [n] | status")
+	}
+	switch args[0] {
+	case "up":
+		done, err := m.up(ctx)
+		for _, mig := range done {
+			fmt.Printf("applied %04d_%s\n", mig.version, mig.name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("database is up to date")
+		}
+		return err
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			var err error
+			if n, err = strconv.Atoi(args[1]); err != nil || n <= 0 {
+				return fmt.Errorf("migrate down: %q is not a positive number", args[1])
+			}
+		}
+		done, err := m.down(ctx, n)
+		for _, mig := range done {
+			fmt.Printf("reverted %04d_%s\n", mig.version, mig.name)
+		}
+		return err
+	case "status":
+		statuses, err := m.status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.appliedAt != "" {
+				state = "applied " + st.appliedAt
+			}
+			fmt.Printf("%04d_%-30s %s\n", st.version, st.name, state)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %q", args[0])
+}
@@ -0,0 +1,7 @@
+DROP PROCEDURE IF EXISTS dbo.sp_GetDepartmentStatistics;
+DROP FUNCTION IF EXISTS dbo.fn_GetWorkerExperience;
+DROP VIEW IF EXISTS vw_MedicalWorkers_Detailed;
+DROP TABLE IF EXISTS medical_workers;
+DROP TABLE IF EXISTS departments;
+DROP TABLE IF EXISTS specializations;
+DROP TABLE IF EXISTS facility_types;
@@ -0,0 +1,12 @@
+-- Removes the demo rows; workers of the demo departments go with them.
+
+DELETE FROM medical_workers WHERE license_number IN (
+    'CARD123456', 'NEUR789012', 'PED345678', 'ORT901234', 'EME567890', 'DER123789', 'ONC456123',
+    'CARD789456', 'NEUR234567', 'PED890123', 'ORT456789', 'EME012345', 'DER678901', 'ONC234567');
+DELETE FROM departments WHERE department_name IN (
+    'Cardiology Department', 'Neurology Department', 'Pediatrics Department', 'Orthopedics Department',
+    'Emergency Department', 'Dermatology Clinic', 'Oncology Research');
+DELETE FROM specializations WHERE specialization_name IN (
+    'Cardiology', 'Neurology', 'Pediatrics', 'Orthopedics', 'Dermatology', 'Emergency Medicine', 'Oncology', 'Psychiatry');
+DELETE FROM facility_types WHERE type_name IN (
+    'Hospital', 'Clinic', 'Specialty Center', 'Urgent Care', 'Research Institute');
@@ -0,0 +1 @@
+ALTER TABLE departments DROP COLUMN row_version;
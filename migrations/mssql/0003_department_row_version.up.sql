@@ -0,0 +1,4 @@
+-- Optimistic concurrency for department updates, as on medical_workers.
+
+IF COL_LENGTH('departments', 'row_version') IS NULL
+ALTER TABLE departments ADD row_version ROWVERSION NOT NULL;
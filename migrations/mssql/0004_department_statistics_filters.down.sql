@@ -0,0 +1,43 @@
+-- Restores the procedure without parameters.
+
+CREATE OR ALTER PROCEDURE dbo.sp_GetDepartmentStatistics
+    AS
+BEGIN
+SELECT
+    d.department_id,
+    d.department_name,
+    ft.type_name as facility_type,
+    d.department_head,
+    d.location,
+    d.phone_number,
+    d.created_date,
+    COUNT(mw.worker_id) as total_workers,
+    AVG(mw.salary) as avg_salary,
+    MIN(mw.salary) as min_salary,
+    MAX(mw.salary) as max_salary,
+    SUM(mw.salary) as total_salary_budget,
+    MIN(mw.hire_date) as earliest_hire_date,
+    MAX(mw.hire_date) as latest_hire_date,
+    COUNT(DISTINCT mw.specialization_id) as unique_specializations_count,
+    -- Add experience statistics
+    AVG(DATEDIFF(YEAR, mw.hire_date, GETDATE())) as avg_years_experience,
+    -- Add most common specialization
+    (SELECT TOP 1 s.specialization_name
+     FROM medical_workers mw2
+              JOIN specializations s ON mw2.specialization_id = s.specialization_id
+     WHERE mw2.department_id = d.department_id
+     GROUP BY mw2.specialization_id, s.specialization_name
+     ORDER BY COUNT(*) DESC) as most_common_specialization
+FROM departments d
+         LEFT JOIN facility_types ft ON d.facility_type_id = ft.facility_type_id
+         LEFT JOIN medical_workers mw ON d.department_id = mw.department_id
+GROUP BY
+    d.department_id,
+    d.department_name,
+    ft.type_name,
+    d.department_head,
+    d.location,
+    d.phone_number,
+    d.created_date
+ORDER BY d.department_name;
+END;
@@ -0,0 +1,79 @@
+-- Soft delete for medical workers: a deleted worker is archived by setting
+-- deleted_at and is removed for good by the purge job after the retention
+-- period. The view exposes the column; statistics ignore archived workers.
+
+IF COL_LENGTH('medical_workers', 'deleted_at') IS NULL
+ALTER TABLE medical_workers ADD deleted_at DATETIME2 NULL;
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_medical_workers_deleted_at')
+CREATE INDEX IX_medical_workers_deleted_at ON medical_workers(deleted_at);
+GO
+
+CREATE OR ALTER VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    mw.image_data,
+    CONVERT(VARCHAR(20), CONVERT(VARBINARY(8), mw.row_version), 1) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
+GO
+
+CREATE OR ALTER PROCEDURE dbo.sp_GetDepartmentStatistics
+    @department_id INT = NULL,
+    @facility_type_id INT = NULL
+    AS
+BEGIN
+SELECT
+    d.department_id,
+    d.department_name,
+    ft.type_name as facility_type,
+    d.department_head,
+    d.location,
+    d.phone_number,
+    d.created_date,
+    COUNT(mw.worker_id) as total_workers,
+    AVG(mw.salary) as avg_salary,
+    MIN(mw.salary) as min_salary,
+    MAX(mw.salary) as max_salary,
+    SUM(mw.salary) as total_salary_budget,
+    MIN(mw.hire_date) as earliest_hire_date,
+    MAX(mw.hire_date) as latest_hire_date,
+    COUNT(DISTINCT mw.specialization_id) as unique_specializations_count,
+    -- Add experience statistics
+    AVG(DATEDIFF(YEAR, mw.hire_date, GETDATE())) as avg_years_experience,
+    -- Add most common specialization
+    (SELECT TOP 1 s.specialization_name
+     FROM medical_workers mw2
+              JOIN specializations s ON mw2.specialization_id = s.specialization_id
+     WHERE mw2.department_id = d.department_id AND mw2.deleted_at IS NULL
+     GROUP BY mw2.specialization_id, s.specialization_name
+     ORDER BY COUNT(*) DESC) as most_common_specialization
+FROM departments d
+         LEFT JOIN facility_types ft ON d.facility_type_id = ft.facility_type_id
+         LEFT JOIN medical_workers mw ON d.department_id = mw.department_id AND mw.deleted_at IS NULL
+WHERE (@department_id IS NULL OR d.department_id = @department_id)
+  AND (@facility_type_id IS NULL OR d.facility_type_id = @facility_type_id)
+GROUP BY
+    d.department_id,
+    d.department_name,
+    ft.type_name,
+    d.department_head,
+    d.location,
+    d.phone_number,
+    d.created_date
+ORDER BY d.department_name;
+END;
@@ -0,0 +1,23 @@
+-- Audit log of changes made through the API. before_data and after_data hold
+-- the record as JSON; either is NULL for creates and deletes.
+
+IF OBJECT_ID('audit_log', 'U') IS NULL
+CREATE TABLE audit_log (
+                           audit_id BIGINT PRIMARY KEY IDENTITY(1, 1),
+                           occurred_at DATETIME2 NOT NULL,
+                           actor VARCHAR(100) NOT NULL,
+                           request_id VARCHAR(64) NULL,
+                           entity VARCHAR(50) NOT NULL,
+                           entity_id INT NOT NULL,
+                           action VARCHAR(20) NOT NULL,
+                           before_data NVARCHAR(MAX) NULL,
+                           after_data NVARCHAR(MAX) NULL
+);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_audit_log_entity')
+CREATE INDEX IX_audit_log_entity ON audit_log(entity, entity_id);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_audit_log_occurred_at')
+CREATE INDEX IX_audit_log_occurred_at ON audit_log(occurred_at);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_medical_workers_history;
+GO
+
+DROP TABLE IF EXISTS medical_workers_history;
@@ -0,0 +1,81 @@
+-- Every state of a medical worker, valid from valid_from until valid_to
+-- (NULL for the current one). A trigger adds a version whenever a tracked
+-- column changes and closes the last one when the worker is removed for good;
+-- image and row_version changes are not versions. The first version of a
+-- worker, including the existing ones, is valid from the hire date.
+
+IF OBJECT_ID('medical_workers_history', 'U') IS NULL
+CREATE TABLE medical_workers_history (
+                                         history_id BIGINT PRIMARY KEY IDENTITY(1, 1),
+                                         worker_id INT NOT NULL,
+                                         first_name VARCHAR(50) NOT NULL,
+                                         last_name VARCHAR(50) NOT NULL,
+                                         email VARCHAR(100),
+                                         phone_number VARCHAR(20),
+                                         department_id INT NOT NULL,
+                                         specialization_id INT NOT NULL,
+                                         hire_date DATE NOT NULL,
+                                         salary DECIMAL(10,2),
+                                         license_number VARCHAR(50),
+                                         deleted_at DATETIME2 NULL,
+                                         valid_from DATETIME2 NOT NULL,
+                                         valid_to DATETIME2 NULL
+);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_medical_workers_history_worker')
+CREATE INDEX IX_medical_workers_history_worker ON medical_workers_history(worker_id, valid_from);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_medical_workers_history_valid')
+CREATE INDEX IX_medical_workers_history_valid ON medical_workers_history(valid_from, valid_to);
+GO
+
+INSERT INTO medical_workers_history
+(worker_id, first_name, last_name, email, phone_number, department_id, specialization_id,
+ hire_date, salary, license_number, deleted_at, valid_from)
+SELECT mw.worker_id, mw.first_name, mw.last_name, mw.email, mw.phone_number, mw.department_id, mw.specialization_id,
+       mw.hire_date, mw.salary, mw.license_number, mw.deleted_at, CAST(mw.hire_date AS DATETIME2)
+FROM medical_workers mw
+WHERE NOT EXISTS (SELECT 1 FROM medical_workers_history h WHERE h.worker_id = mw.worker_id);
+GO
+
+CREATE OR ALTER TRIGGER trg_medical_workers_history
+    ON medical_workers
+    AFTER INSERT, UPDATE, DELETE
+    AS
+BEGIN
+    SET NOCOUNT ON;
+    DECLARE @now DATETIME2 = SYSUTCDATETIME();
+    DECLARE @changed TABLE (worker_id INT PRIMARY KEY);
+
+    -- New rows and rows whose tracked columns differ from before; INTERSECT
+    -- compares NULLs as equal.
+    INSERT INTO @changed (worker_id)
+    SELECT i.worker_id FROM inserted i
+    WHERE NOT EXISTS (
+        SELECT 1 FROM deleted d
+        WHERE d.worker_id = i.worker_id
+          AND EXISTS (
+            SELECT d.first_name, d.last_name, d.email, d.phone_number, d.department_id, d.specialization_id,
+                   d.hire_date, d.salary, d.license_number, d.deleted_at
+            INTERSECT
+            SELECT i.first_name, i.last_name, i.email, i.phone_number, i.department_id, i.specialization_id,
+                   i.hire_date, i.salary, i.license_number, i.deleted_at));
+
+    UPDATE medical_workers_history
+    SET valid_to = @now
+    WHERE valid_to IS NULL
+      AND (worker_id IN (SELECT worker_id FROM @changed)
+        OR worker_id IN (SELECT worker_id FROM deleted WHERE worker_id NOT IN (SELECT worker_id FROM inserted)));
+
+    INSERT INTO medical_workers_history
+    (worker_id, first_name, last_name, email, phone_number, department_id, specialization_id,
+     hire_date, salary, license_number, deleted_at, valid_from)
+    SELECT i.worker_id, i.first_name, i.last_name, i.email, i.phone_number, i.department_id, i.specialization_id,
+           i.hire_date, i.salary, i.license_number, i.deleted_at,
+           CASE WHEN EXISTS (SELECT 1 FROM deleted d WHERE d.worker_id = i.worker_id)
+                THEN @now ELSE CAST(i.hire_date AS DATETIME2) END
+    FROM inserted i
+    WHERE i.worker_id IN (SELECT worker_id FROM @changed);
+END;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS sessions;
+GO
+
+DROP TABLE IF EXISTS users;
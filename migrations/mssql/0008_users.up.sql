@@ -0,0 +1,25 @@
+-- Accounts of the web UI and API and their login sessions. password_hash is
+-- a bcrypt hash. A session is stored under the SHA-256 of its cookie token,
+-- so the table alone does not let anyone log in.
+
+IF OBJECT_ID('users', 'U') IS NULL
+CREATE TABLE users (
+                       user_id INT PRIMARY KEY IDENTITY(1, 1),
+                       username VARCHAR(50) NOT NULL UNIQUE,
+                       password_hash VARCHAR(100) NOT NULL,
+                       created_date DATETIME2 DEFAULT SYSUTCDATETIME()
+);
+GO
+
+IF OBJECT_ID('sessions', 'U') IS NULL
+CREATE TABLE sessions (
+                          session_id CHAR(64) PRIMARY KEY,
+                          user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+                          csrf_token CHAR(64) NOT NULL,
+                          created_at DATETIME2 NOT NULL,
+                          expires_at DATETIME2 NOT NULL
+);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_sessions_expires_at')
+CREATE INDEX IX_sessions_expires_at ON sessions(expires_at);
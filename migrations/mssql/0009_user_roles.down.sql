@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS user_departments;
+GO
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS CK_users_role;
+GO
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS DF_users_role;
+GO
+
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,15 @@
+-- Roles of users and the departments a department head is responsible for.
+-- Existing users become HR so that they keep every right they had.
+
+IF COL_LENGTH('users', 'role') IS NULL
+ALTER TABLE users ADD role VARCHAR(20) NOT NULL
+    CONSTRAINT DF_users_role DEFAULT 'hr'
+    CONSTRAINT CK_users_role CHECK (role IN ('hr', 'department_head', 'receptionist'));
+GO
+
+IF OBJECT_ID('user_departments', 'U') IS NULL
+CREATE TABLE user_departments (
+                                  user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+                                  department_id INT NOT NULL REFERENCES departments(department_id) ON DELETE CASCADE,
+                                  PRIMARY KEY (user_id, department_id)
+);
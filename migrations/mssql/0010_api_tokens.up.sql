@@ -0,0 +1,20 @@
+-- API tokens for other systems. A token acts as its user, limited to its
+-- scopes, e.g. "workers:read departments:read". Only the SHA-256 of the
+-- token is stored; revoked tokens are kept for reference.
+
+IF OBJECT_ID('api_tokens', 'U') IS NULL
+CREATE TABLE api_tokens (
+                            token_id BIGINT PRIMARY KEY IDENTITY(1, 1),
+                            user_id INT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+                            name VARCHAR(50) NOT NULL,
+                            token_hash CHAR(64) NOT NULL UNIQUE,
+                            scopes VARCHAR(500) NOT NULL,
+                            created_at DATETIME2 NOT NULL,
+                            expires_at DATETIME2 NOT NULL,
+                            last_used_at DATETIME2 NULL,
+                            revoked_at DATETIME2 NULL
+);
+GO
+
+IF NOT EXISTS (SELECT 1 FROM sys.indexes WHERE name = 'IX_api_tokens_user_id')
+CREATE INDEX IX_api_tokens_user_id ON api_tokens(user_id);
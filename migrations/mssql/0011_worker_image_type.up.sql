@@ -0,0 +1,5 @@
+-- MIME type of the worker image, detected from its content on upload.
+-- Images stored before have none and are served with the sniffed type.
+
+IF COL_LENGTH('medical_workers', 'image_type') IS NULL
+ALTER TABLE medical_workers ADD image_type VARCHAR(20) NULL;
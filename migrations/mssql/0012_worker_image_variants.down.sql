@@ -0,0 +1 @@
+DROP TABLE IF EXISTS worker_image_variants;
@@ -0,0 +1,12 @@
+-- Resized copies of worker images, e.g. the thumbnails of the worker list.
+-- The original stays in medical_workers.image_data; its copies are replaced
+-- with it and removed with the worker.
+
+IF OBJECT_ID('worker_image_variants', 'U') IS NULL
+CREATE TABLE worker_image_variants (
+                                       worker_id INT NOT NULL REFERENCES medical_workers(worker_id) ON DELETE CASCADE,
+                                       variant VARCHAR(10) NOT NULL,
+                                       image_data VARBINARY(MAX) NOT NULL,
+                                       image_type VARCHAR(20) NOT NULL,
+                                       CONSTRAINT PK_worker_image_variants PRIMARY KEY (worker_id, variant)
+);
@@ -0,0 +1,44 @@
+-- Images already moved to blob storage can not be copied back into the
+-- table, so the migration refuses to run while any worker has one instead of
+-- silently dropping them. Delete those images (or restore a backup) first.
+
+IF EXISTS (SELECT 1 FROM medical_workers WHERE image_key IS NOT NULL)
+    OR EXISTS (SELECT 1 FROM worker_image_variants)
+    THROW 50000, 'Worker images are stored as blobs, delete them before rolling back 0013', 1;
+GO
+
+CREATE OR ALTER VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    mw.image_data,
+    CONVERT(VARCHAR(20), CONVERT(VARBINARY(8), mw.row_version), 1) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
+GO
+
+DROP TABLE IF EXISTS worker_image_variants;
+GO
+
+CREATE TABLE worker_image_variants (
+                                       worker_id INT NOT NULL REFERENCES medical_workers(worker_id) ON DELETE CASCADE,
+                                       variant VARCHAR(10) NOT NULL,
+                                       image_data VARBINARY(MAX) NOT NULL,
+                                       image_type VARCHAR(20) NOT NULL,
+                                       CONSTRAINT PK_worker_image_variants PRIMARY KEY (worker_id, variant)
+);
+GO
+
+ALTER TABLE medical_workers DROP COLUMN image_key;
@@ -0,0 +1,41 @@
+-- Worker images move to blob storage (the filesystem or an S3 bucket) under
+-- the SHA-256 of their content, in image_key. image_data keeps only the
+-- images not yet moved by the "images migrate" command, and the view no
+-- longer carries the image itself. Resized copies are made again on demand.
+
+IF COL_LENGTH('medical_workers', 'image_key') IS NULL
+ALTER TABLE medical_workers ADD image_key CHAR(64) NULL;
+GO
+
+DROP TABLE IF EXISTS worker_image_variants;
+GO
+
+CREATE TABLE worker_image_variants (
+                                       worker_id INT NOT NULL REFERENCES medical_workers(worker_id) ON DELETE CASCADE,
+                                       variant VARCHAR(10) NOT NULL,
+                                       image_key CHAR(64) NOT NULL,
+                                       image_type VARCHAR(20) NOT NULL,
+                                       CONSTRAINT PK_worker_image_variants PRIMARY KEY (worker_id, variant)
+);
+GO
+
+CREATE OR ALTER VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    CASE WHEN mw.image_key IS NULL AND mw.image_data IS NULL THEN 0 ELSE 1 END as has_image,
+    CONVERT(VARCHAR(20), CONVERT(VARBINARY(8), mw.row_version), 1) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
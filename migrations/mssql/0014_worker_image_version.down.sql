@@ -0,0 +1,23 @@
+CREATE OR ALTER VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    CASE WHEN mw.image_key IS NULL AND mw.image_data IS NULL THEN 0 ELSE 1 END as has_image,
+    CONVERT(VARCHAR(20), CONVERT(VARBINARY(8), mw.row_version), 1) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
+GO
+
+ALTER TABLE medical_workers DROP COLUMN image_updated_at;
@@ -0,0 +1,29 @@
+-- The upload time of a worker image is its Last-Modified, and the view
+-- carries image_key so that image URLs in worker responses can change with
+-- the image. Images stored before have no upload time.
+
+IF COL_LENGTH('medical_workers', 'image_updated_at') IS NULL
+ALTER TABLE medical_workers ADD image_updated_at DATETIME2 NULL;
+GO
+
+CREATE OR ALTER VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    CASE WHEN mw.image_key IS NULL AND mw.image_data IS NULL THEN 0 ELSE 1 END as has_image,
+    mw.image_key,
+    CONVERT(VARCHAR(20), CONVERT(VARBINARY(8), mw.row_version), 1) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
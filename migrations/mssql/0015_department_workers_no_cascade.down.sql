@@ -0,0 +1,5 @@
+ALTER TABLE medical_workers DROP CONSTRAINT FK_medical_workers_departments;
+GO
+
+ALTER TABLE medical_workers ADD CONSTRAINT FK_medical_workers_departments
+    FOREIGN KEY (department_id) REFERENCES departments(department_id) ON DELETE CASCADE;
@@ -0,0 +1,19 @@
+-- Deleting a department no longer deletes its workers, archived ones
+-- included: the department must be emptied first, e.g. by moving the workers
+-- with reassign_to. The constraint of the initial schema has a generated
+-- name, so it is looked up.
+
+DECLARE @fk sysname = (
+    SELECT fk.name
+    FROM sys.foreign_keys fk
+             JOIN sys.foreign_key_columns fkc ON fkc.constraint_object_id = fk.object_id
+             JOIN sys.columns c ON c.object_id = fkc.parent_object_id AND c.column_id = fkc.parent_column_id
+    WHERE fk.parent_object_id = OBJECT_ID('medical_workers')
+      AND fk.referenced_object_id = OBJECT_ID('departments')
+      AND c.name = 'department_id');
+IF @fk IS NOT NULL
+EXEC('ALTER TABLE medical_workers DROP CONSTRAINT ' + QUOTENAME(@fk));
+GO
+
+ALTER TABLE medical_workers ADD CONSTRAINT FK_medical_workers_departments
+    FOREIGN KEY (department_id) REFERENCES departments(department_id);
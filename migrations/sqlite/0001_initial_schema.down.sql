@@ -0,0 +1,6 @@
+DROP VIEW IF EXISTS vw_MedicalWorkers_Detailed;
+DROP TRIGGER IF EXISTS trg_medical_workers_row_version;
+DROP TABLE IF EXISTS medical_workers;
+DROP TABLE IF EXISTS departments;
+DROP TABLE IF EXISTS specializations;
+DROP TABLE IF EXISTS facility_types;
@@ -0,0 +1,77 @@
+-- SQLite counterpart of the SQL Server schema for local development.
+-- ROWVERSION is emulated with an integer bumped by a trigger on every update.
+
+CREATE TABLE IF NOT EXISTS facility_types (
+    facility_type_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type_name VARCHAR(50) NOT NULL UNIQUE,
+    description VARCHAR(200),
+    typical_bed_capacity INTEGER,
+    accreditation_required INTEGER DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS specializations (
+    specialization_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    specialization_name VARCHAR(100) NOT NULL UNIQUE,
+    description TEXT,
+    category VARCHAR(50),
+    required_years_training INTEGER,
+    certification_required INTEGER DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS departments (
+    department_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    department_name VARCHAR(100) NOT NULL UNIQUE,
+    department_head VARCHAR(100),
+    location VARCHAR(100),
+    phone_number VARCHAR(20),
+    facility_type_id INTEGER NOT NULL,
+    created_date TEXT DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (facility_type_id) REFERENCES facility_types(facility_type_id)
+);
+
+CREATE TABLE IF NOT EXISTS medical_workers (
+    worker_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    first_name VARCHAR(50) NOT NULL,
+    last_name VARCHAR(50) NOT NULL,
+    email VARCHAR(100) UNIQUE,
+    phone_number VARCHAR(20),
+    department_id INTEGER NOT NULL,
+    specialization_id INTEGER NOT NULL,
+    hire_date DATE NOT NULL,
+    salary DECIMAL(10,2),
+    license_number VARCHAR(50) UNIQUE,
+    image_data BLOB NULL,
+    created_date TEXT DEFAULT CURRENT_TIMESTAMP,
+    row_version INTEGER NOT NULL DEFAULT 1,
+
+    FOREIGN KEY (department_id) REFERENCES departments(department_id) ON DELETE CASCADE,
+    FOREIGN KEY (specialization_id) REFERENCES specializations(specialization_id)
+);
+
+CREATE TRIGGER IF NOT EXISTS trg_medical_workers_row_version
+AFTER UPDATE ON medical_workers
+FOR EACH ROW WHEN NEW.row_version = OLD.row_version
+BEGIN
+    UPDATE medical_workers SET row_version = OLD.row_version + 1 WHERE worker_id = NEW.worker_id;
+END;
+
+CREATE VIEW IF NOT EXISTS vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    mw.image_data,
+    printf('0x%016X', mw.row_version) as row_version
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
@@ -0,0 +1,62 @@
+-- Demo data. Rows that already exist are skipped, so databases seeded before
+-- migrations were introduced are left unchanged. References are looked up by
+-- name so the data can be reloaded after "migrate down".
+
+INSERT OR IGNORE INTO facility_types (type_name, description, typical_bed_capacity, accreditation_required)
+VALUES
+    ('Hospital', 'General medical and surgical facility', 300, 1),
+    ('Clinic', 'Outpatient care facility', 50, 1),
+    ('Specialty Center', 'Focused medical specialty facility', 100, 1),
+    ('Urgent Care', 'Emergency and immediate care facility', 25, 1),
+    ('Research Institute', 'Medical research and clinical trials', 10, 0);
+
+-- Insert data into specializations
+INSERT OR IGNORE INTO specializations (specialization_name, description, category, required_years_training, certification_required)
+VALUES
+    ('Cardiology', 'Heart and cardiovascular system specialist', 'Internal Medicine', 6, 1),
+    ('Neurology', 'Nervous system disorders specialist', 'Internal Medicine', 5, 1),
+    ('Pediatrics', 'Medical care for infants, children, and adolescents', 'Primary Care', 3, 1),
+    ('Orthopedics', 'Musculoskeletal system specialist', 'Surgery', 5, 1),
+    ('Dermatology', 'Skin, hair, and nail conditions specialist', 'Internal Medicine', 4, 1),
+    ('Emergency Medicine', 'Acute medical conditions and trauma', 'Emergency Care', 3, 1),
+    ('Oncology', 'Cancer diagnosis and treatment', 'Internal Medicine', 5, 1),
+    ('Psychiatry', 'Mental health and behavioral disorders', 'Mental Health', 4, 1);
+
+-- Insert data into departments
+WITH v(department_name, department_head, location, phone_number, facility_type) AS (
+    VALUES
+        ('Cardiology Department', 'Dr. Sarah Johnson', 'Main Building, 2nd Floor', '(555) 123-4567', 'Hospital'),
+        ('Neurology Department', 'Dr. Michael Chen', 'Main Building, 3rd Floor', '(555) 123-4568', 'Hospital'),
+        ('Pediatrics Department', 'Dr. Emily Rodriguez', 'West Wing, 1st Floor', '(555) 123-4569', 'Hospital'),
+        ('Orthopedics Department', 'Dr. James Wilson', 'East Wing, 2nd Floor', '(555) 123-4570', 'Hospital'),
+        ('Emergency Department', 'Dr. Lisa Thompson', 'Emergency Building', '(555) 123-4571', 'Hospital'),
+        ('Dermatology Clinic', 'Dr. Robert Brown', 'Clinic Building A', '(555) 123-4572', 'Clinic'),
+        ('Oncology Research', 'Dr. Patricia Lee', 'Research Center', '(555) 123-4573', 'Research Institute')
+)
+INSERT OR IGNORE INTO departments (department_name, department_head, location, phone_number, facility_type_id)
+SELECT v.department_name, v.department_head, v.location, v.phone_number, ft.facility_type_id
+FROM v JOIN facility_types ft ON ft.type_name = v.facility_type;
+
+-- Insert data into medical_workers (without images for now)
+WITH v(first_name, last_name, email, phone_number, department, specialization, hire_date, salary, license_number) AS (
+    VALUES
+        ('Sarah', 'Johnson', 's.johnson@medicalcenter.org', '(555) 111-0001', 'Cardiology Department', 'Cardiology', '2018-03-15', 185000.00, 'CARD123456'),
+        ('Michael', 'Chen', 'm.chen@medicalcenter.org', '(555) 111-0002', 'Neurology Department', 'Neurology', '2019-06-20', 175000.00, 'NEUR789012'),
+        ('Emily', 'Rodriguez', 'e.rodriguez@medicalcenter.org', '(555) 111-0003', 'Pediatrics Department', 'Pediatrics', '2020-01-10', 165000.00, 'PED345678'),
+        ('James', 'Wilson', 'j.wilson@medicalcenter.org', '(555) 111-0004', 'Orthopedics Department', 'Orthopedics', '2017-11-05', 190000.00, 'ORT901234'),
+        ('Lisa', 'Thompson', 'l.thompson@medicalcenter.org', '(555) 111-0005', 'Emergency Department', 'Emergency Medicine', '2019-08-12', 170000.00, 'EME567890'),
+        ('Robert', 'Brown', 'r.brown@medicalcenter.org', '(555) 111-0006', 'Dermatology Clinic', 'Dermatology', '2021-02-28', 160000.00, 'DER123789'),
+        ('Patricia', 'Lee', 'p.lee@medicalcenter.org', '(555) 111-0007', 'Oncology Research', 'Oncology', '2016-04-22', 195000.00, 'ONC456123'),
+        ('David', 'Martinez', 'd.martinez@medicalcenter.org', '(555) 111-0008', 'Cardiology Department', 'Cardiology', '2022-03-01', 145000.00, 'CARD789456'),
+        ('Jennifer', 'Davis', 'j.davis@medicalcenter.org', '(555) 111-0009', 'Neurology Department', 'Neurology', '2023-01-15', 155000.00, 'NEUR234567'),
+        ('Kevin', 'Anderson', 'k.anderson@medicalcenter.org', '(555) 111-0010', 'Pediatrics Department', 'Pediatrics', '2022-07-10', 85000.00, 'PED890123'),
+        ('Amanda', 'Garcia', 'a.garcia@medicalcenter.org', '(555) 111-0011', 'Orthopedics Department', 'Orthopedics', '2020-09-18', 168000.00, 'ORT456789'),
+        ('Brian', 'Taylor', 'b.taylor@medicalcenter.org', '(555) 111-0012', 'Emergency Department', 'Emergency Medicine', '2023-03-01', 162000.00, 'EME012345'),
+        ('Nicole', 'White', 'n.white@medicalcenter.org', '(555) 111-0013', 'Dermatology Clinic', 'Dermatology', '2021-11-30', 135000.00, 'DER678901'),
+        ('Christopher', 'Harris', 'c.harris@medicalcenter.org', '(555) 111-0014', 'Oncology Research', 'Oncology', '2019-05-14', 182000.00, 'ONC234567')
+)
+INSERT OR IGNORE INTO medical_workers (first_name, last_name, email, phone_number, department_id, specialization_id, hire_date, salary, license_number)
+SELECT v.first_name, v.last_name, v.email, v.phone_number, d.department_id, s.specialization_id, v.hire_date, v.salary, v.license_number
+FROM v
+         JOIN departments d ON d.department_name = v.department
+         JOIN specializations s ON s.specialization_name = v.specialization;
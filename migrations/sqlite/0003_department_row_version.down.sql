@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS trg_departments_row_version;
+ALTER TABLE departments DROP COLUMN row_version;
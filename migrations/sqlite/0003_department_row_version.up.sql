@@ -0,0 +1,10 @@
+-- Optimistic concurrency for department updates, as on medical_workers.
+
+ALTER TABLE departments ADD COLUMN row_version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TRIGGER trg_departments_row_version
+AFTER UPDATE ON departments
+FOR EACH ROW WHEN NEW.row_version = OLD.row_version
+BEGIN
+    UPDATE departments SET row_version = OLD.row_version + 1 WHERE department_id = NEW.department_id;
+END;
@@ -0,0 +1,3 @@
+-- Nothing to change: SQLite has no stored procedures, the statistics query
+-- lives in store_sqlite.go.
+SELECT 1;
@@ -0,0 +1,40 @@
+-- Archived workers block the rollback, see the SQL Server migration. RAISE
+-- only works inside a trigger, hence the temporary table.
+
+CREATE TEMP TABLE migration_guard (x INTEGER);
+
+CREATE TEMP TRIGGER migration_guard_archived BEFORE INSERT ON migration_guard
+WHEN EXISTS (SELECT 1 FROM main.medical_workers WHERE deleted_at IS NOT NULL)
+BEGIN
+    SELECT RAISE(ABORT, 'There are archived workers, restore or purge them before rolling back 0005');
+END;
+
+INSERT INTO migration_guard VALUES (1);
+
+DROP TABLE migration_guard;
+
+DROP VIEW vw_MedicalWorkers_Detailed;
+
+CREATE VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    mw.image_data,
+    printf('0x%016X', mw.row_version) as row_version
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
+
+DROP INDEX IX_medical_workers_deleted_at;
+
+ALTER TABLE medical_workers DROP COLUMN deleted_at;
@@ -0,0 +1,28 @@
+-- Soft delete for medical workers, see the SQL Server migration.
+
+ALTER TABLE medical_workers ADD COLUMN deleted_at TEXT NULL;
+
+CREATE INDEX IX_medical_workers_deleted_at ON medical_workers(deleted_at);
+
+DROP VIEW vw_MedicalWorkers_Detailed;
+
+CREATE VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    mw.image_data,
+    printf('0x%016X', mw.row_version) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
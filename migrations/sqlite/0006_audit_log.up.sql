@@ -0,0 +1,17 @@
+-- Audit log of changes made through the API, see the SQL Server migration.
+
+CREATE TABLE audit_log (
+    audit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    occurred_at TEXT NOT NULL,
+    actor VARCHAR(100) NOT NULL,
+    request_id VARCHAR(64) NULL,
+    entity VARCHAR(50) NOT NULL,
+    entity_id INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    before_data TEXT NULL,
+    after_data TEXT NULL
+);
+
+CREATE INDEX IX_audit_log_entity ON audit_log(entity, entity_id);
+
+CREATE INDEX IX_audit_log_occurred_at ON audit_log(occurred_at);
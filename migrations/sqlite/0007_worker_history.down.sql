@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_medical_workers_history_insert;
+DROP TRIGGER IF EXISTS trg_medical_workers_history_update;
+DROP TRIGGER IF EXISTS trg_medical_workers_history_delete;
+DROP TABLE IF EXISTS medical_workers_history;
@@ -0,0 +1,70 @@
+-- Every state of a medical worker, see the SQL Server migration. Times have
+-- millisecond precision so that versions made in the same second keep their
+-- order; a first version starts at the hire date.
+
+CREATE TABLE medical_workers_history (
+    history_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    worker_id INTEGER NOT NULL,
+    first_name VARCHAR(50) NOT NULL,
+    last_name VARCHAR(50) NOT NULL,
+    email VARCHAR(100),
+    phone_number VARCHAR(20),
+    department_id INTEGER NOT NULL,
+    specialization_id INTEGER NOT NULL,
+    hire_date DATE NOT NULL,
+    salary DECIMAL(10,2),
+    license_number VARCHAR(50),
+    deleted_at TEXT NULL,
+    valid_from TEXT NOT NULL,
+    valid_to TEXT NULL
+);
+
+CREATE INDEX IX_medical_workers_history_worker ON medical_workers_history(worker_id, valid_from);
+
+CREATE INDEX IX_medical_workers_history_valid ON medical_workers_history(valid_from, valid_to);
+
+INSERT INTO medical_workers_history
+    (worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date,
+     salary, license_number, deleted_at, valid_from)
+SELECT worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date,
+       salary, license_number, deleted_at, hire_date
+FROM medical_workers;
+
+CREATE TRIGGER trg_medical_workers_history_insert
+AFTER INSERT ON medical_workers
+BEGIN
+    INSERT INTO medical_workers_history
+        (worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date,
+         salary, license_number, deleted_at, valid_from)
+    VALUES (NEW.worker_id, NEW.first_name, NEW.last_name, NEW.email, NEW.phone_number, NEW.department_id, NEW.specialization_id, NEW.hire_date,
+            NEW.salary, NEW.license_number, NEW.deleted_at, NEW.hire_date);
+END;
+
+CREATE TRIGGER trg_medical_workers_history_update
+AFTER UPDATE ON medical_workers
+FOR EACH ROW WHEN OLD.first_name IS NOT NEW.first_name
+   OR OLD.last_name IS NOT NEW.last_name
+   OR OLD.email IS NOT NEW.email
+   OR OLD.phone_number IS NOT NEW.phone_number
+   OR OLD.department_id IS NOT NEW.department_id
+   OR OLD.specialization_id IS NOT NEW.specialization_id
+   OR OLD.hire_date IS NOT NEW.hire_date
+   OR OLD.salary IS NOT NEW.salary
+   OR OLD.license_number IS NOT NEW.license_number
+   OR OLD.deleted_at IS NOT NEW.deleted_at
+BEGIN
+    UPDATE medical_workers_history SET valid_to = strftime('%Y-%m-%d %H:%M:%f', 'now')
+    WHERE worker_id = OLD.worker_id AND valid_to IS NULL;
+    INSERT INTO medical_workers_history
+        (worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date,
+         salary, license_number, deleted_at, valid_from)
+    VALUES (NEW.worker_id, NEW.first_name, NEW.last_name, NEW.email, NEW.phone_number, NEW.department_id, NEW.specialization_id, NEW.hire_date,
+            NEW.salary, NEW.license_number, NEW.deleted_at, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER trg_medical_workers_history_delete
+AFTER DELETE ON medical_workers
+BEGIN
+    UPDATE medical_workers_history SET valid_to = strftime('%Y-%m-%d %H:%M:%f', 'now')
+    WHERE worker_id = OLD.worker_id AND valid_to IS NULL;
+END;
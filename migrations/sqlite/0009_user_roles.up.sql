@@ -0,0 +1,11 @@
+-- Roles of users and the departments of department heads, see the SQL Server
+-- migration.
+
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'hr'
+    CHECK (role IN ('hr', 'department_head', 'receptionist'));
+
+CREATE TABLE user_departments (
+    user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    department_id INTEGER NOT NULL REFERENCES departments(department_id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, department_id)
+);
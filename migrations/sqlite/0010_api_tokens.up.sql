@@ -0,0 +1,15 @@
+-- API tokens for other systems, see the SQL Server migration.
+
+CREATE TABLE api_tokens (
+    token_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    scopes VARCHAR(500) NOT NULL,
+    created_at TEXT NOT NULL,
+    expires_at TEXT NOT NULL,
+    last_used_at TEXT NULL,
+    revoked_at TEXT NULL
+);
+
+CREATE INDEX IX_api_tokens_user_id ON api_tokens(user_id);
@@ -0,0 +1 @@
+ALTER TABLE medical_workers DROP COLUMN image_type;
@@ -0,0 +1,3 @@
+-- MIME type of the worker image, see the SQL Server migration.
+
+ALTER TABLE medical_workers ADD COLUMN image_type VARCHAR(20) NULL;
@@ -0,0 +1,9 @@
+-- Resized copies of worker images, see the SQL Server migration.
+
+CREATE TABLE worker_image_variants (
+    worker_id INTEGER NOT NULL REFERENCES medical_workers(worker_id) ON DELETE CASCADE,
+    variant VARCHAR(10) NOT NULL,
+    image_data BLOB NOT NULL,
+    image_type VARCHAR(20) NOT NULL,
+    PRIMARY KEY (worker_id, variant)
+);
@@ -0,0 +1,51 @@
+-- Images in blob storage can not be copied back, so the migration refuses to
+-- run while any worker has one, see the SQL Server migration. RAISE only
+-- works inside a trigger, hence the temporary table.
+
+CREATE TEMP TABLE migration_guard (x INTEGER);
+
+CREATE TEMP TRIGGER migration_guard_images BEFORE INSERT ON migration_guard
+WHEN EXISTS (SELECT 1 FROM main.medical_workers WHERE image_key IS NOT NULL)
+    OR EXISTS (SELECT 1 FROM main.worker_image_variants)
+BEGIN
+    SELECT RAISE(ABORT, 'Worker images are stored as blobs, delete them before rolling back 0013');
+END;
+
+INSERT INTO migration_guard VALUES (1);
+
+DROP TABLE migration_guard;
+
+DROP VIEW vw_MedicalWorkers_Detailed;
+
+CREATE VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    mw.image_data,
+    printf('0x%016X', mw.row_version) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
+
+DROP TABLE worker_image_variants;
+
+CREATE TABLE worker_image_variants (
+    worker_id INTEGER NOT NULL REFERENCES medical_workers(worker_id) ON DELETE CASCADE,
+    variant VARCHAR(10) NOT NULL,
+    image_data BLOB NOT NULL,
+    image_type VARCHAR(20) NOT NULL,
+    PRIMARY KEY (worker_id, variant)
+);
+
+ALTER TABLE medical_workers DROP COLUMN image_key;
@@ -0,0 +1,36 @@
+-- Worker images move to blob storage, see the SQL Server migration.
+
+ALTER TABLE medical_workers ADD COLUMN image_key CHAR(64) NULL;
+
+DROP TABLE worker_image_variants;
+
+CREATE TABLE worker_image_variants (
+    worker_id INTEGER NOT NULL REFERENCES medical_workers(worker_id) ON DELETE CASCADE,
+    variant VARCHAR(10) NOT NULL,
+    image_key CHAR(64) NOT NULL,
+    image_type VARCHAR(20) NOT NULL,
+    PRIMARY KEY (worker_id, variant)
+);
+
+DROP VIEW vw_MedicalWorkers_Detailed;
+
+CREATE VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    CASE WHEN mw.image_key IS NULL AND mw.image_data IS NULL THEN 0 ELSE 1 END as has_image,
+    printf('0x%016X', mw.row_version) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
@@ -0,0 +1,24 @@
+DROP VIEW vw_MedicalWorkers_Detailed;
+
+CREATE VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    CASE WHEN mw.image_key IS NULL AND mw.image_data IS NULL THEN 0 ELSE 1 END as has_image,
+    printf('0x%016X', mw.row_version) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
+
+ALTER TABLE medical_workers DROP COLUMN image_updated_at;
@@ -0,0 +1,109 @@
+DROP VIEW vw_MedicalWorkers_Detailed;
+
+CREATE TABLE medical_workers_new (
+    worker_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    first_name VARCHAR(50) NOT NULL,
+    last_name VARCHAR(50) NOT NULL,
+    email VARCHAR(100) UNIQUE,
+    phone_number VARCHAR(20),
+    department_id INTEGER NOT NULL,
+    specialization_id INTEGER NOT NULL,
+    hire_date DATE NOT NULL,
+    salary DECIMAL(10,2),
+    license_number VARCHAR(50) UNIQUE,
+    image_data BLOB NULL,
+    created_date TEXT DEFAULT CURRENT_TIMESTAMP,
+    row_version INTEGER NOT NULL DEFAULT 1,
+    deleted_at TEXT NULL,
+    image_type VARCHAR(20) NULL,
+    image_key CHAR(64) NULL,
+    image_updated_at TEXT NULL,
+
+    FOREIGN KEY (department_id) REFERENCES departments(department_id) ON DELETE CASCADE,
+    FOREIGN KEY (specialization_id) REFERENCES specializations(specialization_id)
+);
+
+INSERT INTO medical_workers_new (worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date,
+    salary, license_number, image_data, created_date, row_version, deleted_at, image_type, image_key, image_updated_at)
+SELECT worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date,
+    salary, license_number, image_data, created_date, row_version, deleted_at, image_type, image_key, image_updated_at
+FROM medical_workers;
+
+-- Keep the AUTOINCREMENT counter, so that ids of purged workers are not reused.
+DELETE FROM sqlite_sequence WHERE name = 'medical_workers_new';
+INSERT INTO sqlite_sequence (name, seq)
+SELECT 'medical_workers_new', seq FROM sqlite_sequence WHERE name = 'medical_workers';
+
+DROP TABLE medical_workers;
+
+ALTER TABLE medical_workers_new RENAME TO medical_workers;
+
+CREATE INDEX IX_medical_workers_deleted_at ON medical_workers(deleted_at);
+
+CREATE TRIGGER trg_medical_workers_row_version
+AFTER UPDATE ON medical_workers
+FOR EACH ROW WHEN NEW.row_version = OLD.row_version
+BEGIN
+    UPDATE medical_workers SET row_version = OLD.row_version + 1 WHERE worker_id = NEW.worker_id;
+END;
+
+CREATE TRIGGER trg_medical_workers_history_insert
+AFTER INSERT ON medical_workers
+BEGIN
+    INSERT INTO medical_workers_history
+        (worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date,
+         salary, license_number, deleted_at, valid_from)
+    VALUES (NEW.worker_id, NEW.first_name, NEW.last_name, NEW.email, NEW.phone_number, NEW.department_id, NEW.specialization_id, NEW.hire_date,
+            NEW.salary, NEW.license_number, NEW.deleted_at, NEW.hire_date);
+END;
+
+CREATE TRIGGER trg_medical_workers_history_update
+AFTER UPDATE ON medical_workers
+FOR EACH ROW WHEN OLD.first_name IS NOT NEW.first_name
+   OR OLD.last_name IS NOT NEW.last_name
+   OR OLD.email IS NOT NEW.email
+   OR OLD.phone_number IS NOT NEW.phone_number
+   OR OLD.department_id IS NOT NEW.department_id
+   OR OLD.specialization_id IS NOT NEW.specialization_id
+   OR OLD.hire_date IS NOT NEW.hire_date
+   OR OLD.salary IS NOT NEW.salary
+   OR OLD.license_number IS NOT NEW.license_number
+   OR OLD.deleted_at IS NOT NEW.deleted_at
+BEGIN
+    UPDATE medical_workers_history SET valid_to = strftime('%Y-%m-%d %H:%M:%f', 'now')
+    WHERE worker_id = OLD.worker_id AND valid_to IS NULL;
+    INSERT INTO medical_workers_history
+        (worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date,
+         salary, license_number, deleted_at, valid_from)
+    VALUES (NEW.worker_id, NEW.first_name, NEW.last_name, NEW.email, NEW.phone_number, NEW.department_id, NEW.specialization_id, NEW.hire_date,
+            NEW.salary, NEW.license_number, NEW.deleted_at, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+END;
+
+CREATE TRIGGER trg_medical_workers_history_delete
+AFTER DELETE ON medical_workers
+BEGIN
+    UPDATE medical_workers_history SET valid_to = strftime('%Y-%m-%d %H:%M:%f', 'now')
+    WHERE worker_id = OLD.worker_id AND valid_to IS NULL;
+END;
+
+CREATE VIEW vw_MedicalWorkers_Detailed AS
+SELECT
+    mw.worker_id,
+    mw.first_name,
+    mw.last_name,
+    mw.email,
+    mw.phone_number,
+    mw.department_id,
+    d.department_name,
+    mw.specialization_id,
+    s.specialization_name,
+    mw.hire_date,
+    mw.salary,
+    mw.license_number,
+    CASE WHEN mw.image_key IS NULL AND mw.image_data IS NULL THEN 0 ELSE 1 END as has_image,
+    mw.image_key,
+    printf('0x%016X', mw.row_version) as row_version,
+    mw.deleted_at
+FROM medical_workers mw
+         LEFT JOIN departments d ON mw.department_id = d.department_id
+         LEFT JOIN specializations s ON mw.specialization_id = s.specialization_id;
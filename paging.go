@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// sortColumn is a sortable column of vw_MedicalWorkers_Detailed. Nullable
+// columns are sorted through COALESCE so that keyset comparisons stay total.
+type sortColumn struct {
+	expr    string
+	numeric bool
+	value   func(mw *MedicalWorker) interface{}
+}
+
+var workerSortColumns = map[string]sortColumn{
+	"worker_id":           {"worker_id", true, func(mw *MedicalWorker) interface{} { return mw.WorkerID }},
+	"first_name":          {"first_name", false, func(mw *MedicalWorker) interface{} { return mw.FirstName }},
+	"last_name":           {"last_name", false, func(mw *MedicalWorker) interface{} { return mw.LastName }},
+	"email":               {"COALESCE(email, '')", false, func(mw *MedicalWorker) interface{} { return mw.Email }},
+	"phone_number":        {"COALESCE(phone_number, '')", false, func(mw *MedicalWorker) interface{} { return mw.PhoneNumber }},
+	"department_id":       {"department_id", true, func(mw *MedicalWorker) interface{} { return mw.DepartmentID }},
+	"department_name":     {"COALESCE(department_name, '')", false, func(mw *MedicalWorker) interface{} { return mw.DepartmentName }},
+	"specialization_id":   {"specialization_id", true, func(mw *MedicalWorker) interface{} { return mw.SpecializationID }},
+	"specialization_name": {"COALESCE(specialization_name, '')", false, func(mw *MedicalWorker) interface{} { return mw.SpecializationName }},
+	"hire_date":           {"hire_date", false, func(mw *MedicalWorker) interface{} { return dateOnly(mw.HireDate) }},
+	"salary":              {"COALESCE(salary, 0)", true, func(mw *MedicalWorker) interface{} { return mw.Salary }},
+	"license_number":      {"COALESCE(license_number, '')", false, func(mw *MedicalWorker) interface{} { return mw.LicenseNumber }},
+}
+
+type sortKey struct {
+	column string
+	desc   bool
+}
+
+type pageRequest struct {
+	sortParam string
+	sort      []sortKey
+	limit     int
+	offset    int
+	cursor    []interface{}
+}
+
+type pageCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+// parsePage reads sort, limit, offset and cursor. Without limit, offset or
+// cursor the whole result is returned, as before pagination existed.
+func parsePage(values url.Values) (*pageRequest, error) {
+	var errs FieldErrors
+	page := &pageRequest{}
+	sortParam := strings.TrimSpace(values.Get("sort"))
+	if sortParam == "" {
+		sortParam = "last_name,first_name"
+	}
+	keys, err := parseSort(sortParam)
+	if err != nil {
+		errs = append(errs, FieldError{Field: "sort", Message: err.Error()})
+	}
+	page.sortParam, page.sort = sortParam, keys
+	if raw := values.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageSize {
+			errs = append(errs, FieldError{Field: "limit", Message: fmt.Sprintf("must be an integer between 1 and %d", maxPageSize)})
+		}
+		page.limit = n
+	}
+	if raw := values.Get("offset"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			errs = append(errs, FieldError{Field: "offset", Message: "must be a non-negative integer"})
+		}
+		page.offset = n
+	}
+	if raw := values.Get("cursor"); raw != "" {
+		if values.Get("offset") != "" {
+			errs = append(errs, FieldError{Field: "cursor", Message: "cannot be combined with offset"})
+		} else if page.cursor, err = decodeCursor(raw, sortParam, keys); err != nil {
+			errs = append(errs, FieldError{Field: "cursor", Message: err.Error()})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if page.limit == 0 && (page.offset > 0 || page.cursor != nil) {
+		page.limit = defaultPageSize
+	}
+	return page, nil
+}
+
+func parseSort(raw string) ([]sortKey, error) {
+	var keys []sortKey
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		name, dir, _ := strings.Cut(strings.TrimSpace(part), ":")
+		if _, ok := workerSortColumns[name]; !ok {
+			return nil, fmt.Errorf("unknown sort column %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("column %q listed more than once", name)
+		}
+		seen[name] = true
+		switch strings.ToLower(dir) {
+		case "", "asc":
+			keys = append(keys, sortKey{column: name})
+		case "desc":
+			keys = append(keys, sortKey{column: name, desc: true})
+		default:
+			return nil, fmt.Errorf("direction for %q must be asc or desc", name)
+		}
+	}
+	if !seen["worker_id"] {
+		keys = append(keys, sortKey{column: "worker_id"})
+	}
+	return keys, nil
+}
+
+func decodeCursor(raw, sortParam string, keys []sortKey) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("is malformed")
+	}
+	var c pageCursor
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Values) != len(keys) {
+		return nil, fmt.Errorf("is malformed")
+	}
+	if c.Sort != sortParam {
+		return nil, fmt.Errorf("was issued for a different sort order")
+	}
+	for i, k := range keys {
+		_, isNumber := c.Values[i].(float64)
+		_, isString := c.Values[i].(string)
+		if numeric := workerSortColumns[k.column].numeric; (numeric && !isNumber) || (!numeric && !isString) {
+			return nil, fmt.Errorf("is malformed")
+		}
+	}
+	return c.Values, nil
+}
+
+func (p *pageRequest) nextCursor(mw *MedicalWorker) string {
+	c := pageCursor{Sort: p.sortParam}
+	for _, k := range p.sort {
+		c.Values = append(c.Values, workerSortColumns[k.column].value(mw))
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (p *pageRequest) orderBy() string {
+	parts := make([]string, len(p.sort))
+	for i, k := range p.sort {
+		parts[i] = workerSortColumns[k.column].expr
+		if k.desc {
+			parts[i] += " DESC"
+		}
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// seekAfter restricts the query to rows strictly after the cursor position:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with < for descending keys.
+func (p *pageRequest) seekAfter(qb *queryBuilder) {
+	if p.cursor == nil {
+		return
+	}
+	var alternatives []string
+	for i, k := range p.sort {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, workerSortColumns[p.sort[j].column].expr+" = "+qb.bind(p.cursor[j]))
+		}
+		op := " > "
+		if k.desc {
+			op = " < "
+		}
+		terms = append(terms, workerSortColumns[k.column].expr+op+qb.bind(p.cursor[i]))
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	qb.conditions = append(qb.conditions, "("+strings.Join(alternatives, " OR ")+")")
+}
+
+func dateOnly(s string) string {
+	if len(s) > 10 {
+		return s[:10]
+	}
+	return s
+}
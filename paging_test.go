@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		query  string
+		sort   []sortKey
+		limit  int
+		offset int
+		fields []string
+	}{
+		{"", []sortKey{{"last_name", false}, {"first_name", false}, {"worker_id", false}}, 0, 0, nil},
+		{"sort=salary:desc,worker_id", []sortKey{{"salary", true}, {"worker_id", false}}, 0, 0, nil},
+		{"sort=hire_date:ASC", []sortKey{{"hire_date", false}, {"worker_id", false}}, 0, 0, nil},
+		{"limit=10&offset=20", nil, 10, 20, nil},
+		{"offset=5", nil, defaultPageSize, 5, nil},
+		{"limit=500", nil, 500, 0, nil},
+		{"sort=image_data", nil, 0, 0, []string{"sort"}},
+		{"sort=salary,salary:desc", nil, 0, 0, []string{"sort"}},
+		{"sort=salary:up", nil, 0, 0, []string{"sort"}},
+		{"limit=0", nil, 0, 0, []string{"limit"}},
+		{"limit=501", nil, 0, 0, []string{"limit"}},
+		{"limit=ten&offset=-1", nil, 0, 0, []string{"limit", "offset"}},
+		{"cursor=abc&offset=1", nil, 0, 0, []string{"cursor"}},
+		{"cursor=!!!", nil, 0, 0, []string{"cursor"}},
+		{"sort=nope&limit=0&offset=x", nil, 0, 0, []string{"sort", "limit", "offset"}},
+	}
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		page, err := parsePage(values)
+		if tt.fields != nil {
+			var errs FieldErrors
+			if !errors.As(err, &errs) {
+				t.Errorf("%q: error %v, want field errors", tt.query, err)
+				continue
+			}
+			var fields []string
+			for _, fe := range errs {
+				fields = append(fields, fe.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("%q: errors for %v, want %v", tt.query, fields, tt.fields)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		if tt.sort != nil && !reflect.DeepEqual(page.sort, tt.sort) {
+			t.Errorf("%q: sort = %v, want %v", tt.query, page.sort, tt.sort)
+		}
+		if page.limit != tt.limit || page.offset != tt.offset {
+			t.Errorf("%q: limit %d offset %d, want %d and %d", tt.query, page.limit, page.offset, tt.limit, tt.offset)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	mw := &MedicalWorker{
+		WorkerID:  42,
+		LastName:  "Иванов",
+		FirstName: "Пётр",
+		HireDate:  "2020-03-01T00:00:00Z",
+		Salary:    75000.5,
+	}
+	for _, sort := range []string{"last_name,first_name", "salary:desc", "hire_date,worker_id:desc"} {
+		page, err := parsePage(url.Values{"sort": {sort}})
+		if err != nil {
+			t.Fatalf("%s: %v", sort, err)
+		}
+		cursor := page.nextCursor(mw)
+
+		next, err := parsePage(url.Values{"sort": {sort}, "cursor": {cursor}})
+		if err != nil {
+			t.Fatalf("%s: cursor rejected: %v", sort, err)
+		}
+		var want []interface{}
+		for _, k := range page.sort {
+			v := workerSortColumns[k.column].value(mw)
+			if n, ok := v.(int); ok {
+				v = float64(n)
+			}
+			want = append(want, v)
+		}
+		if !reflect.DeepEqual(next.cursor, want) {
+			t.Errorf("%s: cursor values %v, want %v", sort, next.cursor, want)
+		}
+		if next.limit != defaultPageSize {
+			t.Errorf("%s: limit %d, want the default", sort, next.limit)
+		}
+
+		qb := &queryBuilder{}
+		next.seekAfter(qb)
+		if len(qb.args) == 0 || len(qb.conditions) != 1 {
+			t.Errorf("%s: seekAfter added %v with %v", sort, qb.conditions, qb.args)
+		}
+	}
+}
+
+func TestCursorRejected(t *testing.T) {
+	page, _ := parsePage(url.Values{"sort": {"salary"}})
+	cursor := page.nextCursor(&MedicalWorker{WorkerID: 1, Salary: 10})
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name, sort, cursor, message string
+	}{
+		{"other sort", "last_name", cursor, "different sort order"},
+		{"not base64", "salary", "***", "malformed"},
+		{"not json", "salary", encode("salary"), "malformed"},
+		{"too few values", "salary", encode(`{"s":"salary","v":[10]}`), "malformed"},
+		{"string for a number", "salary", encode(`{"s":"salary","v":["10",1]}`), "malformed"},
+		{"number for a string", "last_name", encode(`{"s":"last_name","v":[1,1]}`), "malformed"},
+	}
+	for _, tt := range tests {
+		_, err := parsePage(url.Values{"sort": {tt.sort}, "cursor": {tt.cursor}})
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.message)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// workerFields are the editable worker fields. Each is also the name of its
+// medical_workers column.
+var workerFields = []string{
+	"first_name", "last_name", "email", "phone_number",
+	"department_id", "specialization_id", "hire_date", "salary", "license_number",
+}
+
+// workerPatchFields are the worker fields a merge patch may set.
+var workerPatchFields = map[string]bool{}
+
+func init() {
+	for _, f := range workerFields {
+		workerPatchFields[f] = true
+	}
+}
+
+// workerNullableFields may be removed with null; every other field is required.
+var workerNullableFields = map[string]bool{"phone_number": true}
+
+// mergeWorkerPatch applies a JSON merge patch (RFC 7396) to the current state
+// of a worker. It returns the merged worker and the sorted fields the patch
+// touches. Unknown fields and values of the wrong type are FieldErrors.
+func mergeWorkerPatch(current *MedicalWorker, patch map[string]json.RawMessage) (*WorkerInput, []string, error) {
+	merged := current.input()
+	var errs FieldErrors
+	var fields []string
+	for field, raw := range patch {
+		if !workerPatchFields[field] {
+			errs = append(errs, FieldError{Field: field, Message: "is not a worker field"})
+			continue
+		}
+		fields = append(fields, field)
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			if !workerNullableFields[field] {
+				errs = append(errs, FieldError{Field: field, Message: "must not be null"})
+				continue
+			}
+			raw = json.RawMessage(`""`)
+		}
+		one, _ := json.Marshal(map[string]json.RawMessage{field: raw})
+		if err := json.Unmarshal(one, &merged); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				errs = append(errs, FieldError{Field: field, Message: "must be a " + jsonTypeName(typeErr.Type.Kind().String())})
+				continue
+			}
+			return nil, nil, err
+		}
+	}
+	sort.Strings(fields)
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return &merged, fields, errs.orNil()
+}
+
+// validatePatched validates a merged worker but reports only the fields the
+// patch set, so that a stored value that no longer passes validation, such as
+// a phone number in an old format, does not block changes to other fields.
+func (in *WorkerInput) validatePatched(now time.Time, fields []string) error {
+	var errs FieldErrors
+	if !errors.As(in.validate(now), &errs) {
+		return nil
+	}
+	var patched FieldErrors
+	for _, fe := range errs {
+		if i := sort.SearchStrings(fields, fe.Field); i < len(fields) && fields[i] == fe.Field {
+			patched = append(patched, fe)
+		}
+	}
+	return patched.orNil()
+}
+
+func jsonTypeName(kind string) string {
+	switch kind {
+	case "int", "int64":
+		return "whole number"
+	case "float64":
+		return "number"
+	}
+	return kind
+}
+
+// input returns the editable part of a stored worker.
+func (mw *MedicalWorker) input() WorkerInput {
+	return WorkerInput{
+		FirstName:        mw.FirstName,
+		LastName:         mw.LastName,
+		Email:            mw.Email,
+		PhoneNumber:      mw.PhoneNumber,
+		DepartmentID:     mw.DepartmentID,
+		SpecializationID: mw.SpecializationID,
+		HireDate:         dateOnly(mw.HireDate),
+		Salary:           mw.Salary,
+		LicenseNumber:    mw.LicenseNumber,
+	}
+}
+
+// columnValues returns the values of the given fields, keyed by column.
+func (in *WorkerInput) columnValues(fields []string) map[string]interface{} {
+	all := map[string]interface{}{
+		"first_name":        in.FirstName,
+		"last_name":         in.LastName,
+		"email":             in.Email,
+		"phone_number":      in.PhoneNumber,
+		"department_id":     in.DepartmentID,
+		"specialization_id": in.SpecializationID,
+		"hire_date":         in.HireDate,
+		"salary":            in.Salary,
+		"license_number":    in.LicenseNumber,
+	}
+	values := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		values[f] = all[f]
+	}
+	return values
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeWorkerPatch(t *testing.T) {
+	current := &MedicalWorker{
+		WorkerID:         7,
+		FirstName:        "Пётр",
+		LastName:         "Иванов",
+		Email:            "ivanov@example.com",
+		PhoneNumber:      "+7 495 123-45-67",
+		DepartmentID:     1,
+		DepartmentName:   "Хирургия",
+		SpecializationID: 2,
+		HireDate:         "2020-03-01T00:00:00Z",
+		Salary:           75000,
+		LicenseNumber:    "LIC-1",
+	}
+	tests := []struct {
+		name   string
+		patch  string
+		change func(in *WorkerInput)
+		fields []string
+		errs   FieldErrors
+	}{
+		{"empty", `{}`, func(in *WorkerInput) {}, nil, nil},
+		{"one field", `{"salary": 80000.5}`, func(in *WorkerInput) { in.Salary = 80000.5 }, []string{"salary"}, nil},
+		{"several fields", `{"last_name": "Петров", "department_id": 3}`,
+			func(in *WorkerInput) { in.LastName, in.DepartmentID = "Петров", 3 }, []string{"department_id", "last_name"}, nil},
+		{"same value", `{"email": "ivanov@example.com"}`, func(in *WorkerInput) {}, []string{"email"}, nil},
+		{"null clears a nullable field", `{"phone_number": null}`, func(in *WorkerInput) { in.PhoneNumber = "" },
+			[]string{"phone_number"}, nil},
+		{"null for a required field", `{"email": null}`, nil, nil,
+			FieldErrors{{Field: "email", Message: "must not be null"}}},
+		{"unknown fields", `{"worker_id": 1, "department_name": "x"}`, nil, nil,
+			FieldErrors{{Field: "department_name", Message: "is not a worker field"}, {Field: "worker_id", Message: "is not a worker field"}}},
+		{"string for a number", `{"salary": "lots"}`, nil, nil,
+			FieldErrors{{Field: "salary", Message: "must be a number"}}},
+		{"fraction for an id", `{"department_id": 1.5}`, nil, nil,
+			FieldErrors{{Field: "department_id", Message: "must be a whole number"}}},
+		{"number for a string", `{"first_name": 5}`, nil, nil,
+			FieldErrors{{Field: "first_name", Message: "must be a string"}}},
+		{"all problems at once", `{"salary": true, "role": "x", "last_name": null, "email": "new@example.com"}`, nil, nil,
+			FieldErrors{
+				{Field: "last_name", Message: "must not be null"},
+				{Field: "role", Message: "is not a worker field"},
+				{Field: "salary", Message: "must be a number"},
+			}},
+	}
+	for _, tt := range tests {
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		merged, fields, err := mergeWorkerPatch(current, patch)
+		if tt.errs != nil {
+			var errs FieldErrors
+			if !errors.As(err, &errs) || !reflect.DeepEqual(errs, tt.errs) {
+				t.Errorf("%s: error %v, want %v", tt.name, err, tt.errs)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		want := current.input()
+		tt.change(&want)
+		if !reflect.DeepEqual(*merged, want) {
+			t.Errorf("%s: merged %+v, want %+v", tt.name, *merged, want)
+		}
+		if !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("%s: fields %v, want %v", tt.name, fields, tt.fields)
+		}
+	}
+}
+
+func TestMergeWorkerPatchKeepsCurrent(t *testing.T) {
+	current := &MedicalWorker{FirstName: "Пётр", HireDate: "2020-03-01"}
+	patch := map[string]json.RawMessage{"first_name": json.RawMessage(`"Павел"`)}
+	if _, _, err := mergeWorkerPatch(current, patch); err != nil {
+		t.Fatal(err)
+	}
+	if current.FirstName != "Пётр" {
+		t.Errorf("current worker changed to %q", current.FirstName)
+	}
+}
+
+func TestValidatePatched(t *testing.T) {
+	// A worker saved before validation existed, with a phone number and a
+	// license number that no longer pass it.
+	current := &MedicalWorker{
+		FirstName:        "Пётр",
+		LastName:         "Иванов",
+		Email:            "ivanov@example.com",
+		PhoneNumber:      "ext. 42",
+		DepartmentID:     1,
+		SpecializationID: 2,
+		HireDate:         "2020-03-01",
+		Salary:           75000,
+	}
+	tests := []struct {
+		patch  string
+		fields []string
+	}{
+		{`{"salary": 80000}`, nil},
+		{`{"last_name": "Петров", "department_id": 3}`, nil},
+		{`{"phone_number": null}`, nil},
+		{`{"phone_number": "+7 495 123-45-67"}`, nil},
+		{`{"phone_number": "ext. 43"}`, []string{"phone_number"}},
+		{`{"salary": -1}`, []string{"salary"}},
+		{`{"license_number": ""}`, []string{"license_number"}},
+		{`{"salary": -1, "first_name": " "}`, []string{"first_name", "salary"}},
+	}
+	for _, tt := range tests {
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		merged, fields, err := mergeWorkerPatch(current, patch)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.patch, err)
+		}
+		err = merged.validatePatched(time.Now(), fields)
+		if got := fieldsOf(t, err); !reflect.DeepEqual(got, tt.fields) {
+			t.Errorf("%s: errors for %v, want %v", tt.patch, got, tt.fields)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Handlers for the facility type and specialization lookup tables.
+
+func (s *server) getFacilityType(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid facility type ID"))
+		return
+	}
+	ft, err := s.refs.GetFacilityType(r.Context(), id)
+	if err != nil {
+		writeError(w, r, storeError(err, "Facility type"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ft)
+}
+
+func (s *server) addFacilityType(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditReferences) {
+		return
+	}
+	var in FacilityTypeInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		log.Printf("Error decoding request: %v", err)
+		writeError(w, r, badRequest("Invalid JSON"))
+		return
+	}
+	if err := in.validate(); err != nil {
+		writeError(w, r, validationFailed(err))
+		return
+	}
+	id, err := s.refs.CreateFacilityType(r.Context(), &in)
+	if err != nil {
+		writeError(w, r, referenceWriteError(err, "facility type", "type_name", in.TypeName))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":          "Facility type added successfully",
+		"facility_type_id": id,
+	})
+}
+
+func (s *server) updateFacilityType(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditReferences) {
+		return
+	}
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid facility type ID"))
+		return
+	}
+	var in FacilityTypeInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		log.Printf("Error decoding update request: %v", err)
+		writeError(w, r, badRequest("Invalid JSON"))
+		return
+	}
+	if err := in.validate(); err != nil {
+		writeError(w, r, validationFailed(err))
+		return
+	}
+	if err := s.refs.UpdateFacilityType(r.Context(), id, &in); err != nil {
+		writeError(w, r, referenceWriteError(err, "facility type", "type_name", in.TypeName))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Facility type updated successfully"})
+}
+
+func (s *server) deleteFacilityType(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditReferences) {
+		return
+	}
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid facility type ID"))
+		return
+	}
+	refs, err := s.refs.DeleteFacilityType(r.Context(), id)
+	if err != nil {
+		writeError(w, r, referenceDeleteError(err, "Facility type", refs))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Facility type deleted successfully"})
+}
+
+func (s *server) getSpecialization(w http.ResponseWriter, r *http.Request) {
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid specialization ID"))
+		return
+	}
+	sp, err := s.refs.GetSpecialization(r.Context(), id)
+	if err != nil {
+		writeError(w, r, storeError(err, "Specialization"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sp)
+}
+
+func (s *server) addSpecialization(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditReferences) {
+		return
+	}
+	var in SpecializationInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		log.Printf("Error decoding request: %v", err)
+		writeError(w, r, badRequest("Invalid JSON"))
+		return
+	}
+	if err := in.validate(); err != nil {
+		writeError(w, r, validationFailed(err))
+		return
+	}
+	id, err := s.refs.CreateSpecialization(r.Context(), &in)
+	if err != nil {
+		writeError(w, r, referenceWriteError(err, "specialization", "specialization_name", in.SpecializationName))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":           "Specialization added successfully",
+		"specialization_id": id,
+	})
+}
+
+func (s *server) updateSpecialization(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditReferences) {
+		return
+	}
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid specialization ID"))
+		return
+	}
+	var in SpecializationInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		log.Printf("Error decoding update request: %v", err)
+		writeError(w, r, badRequest("Invalid JSON"))
+		return
+	}
+	if err := in.validate(); err != nil {
+		writeError(w, r, validationFailed(err))
+		return
+	}
+	if err := s.refs.UpdateSpecialization(r.Context(), id, &in); err != nil {
+		writeError(w, r, referenceWriteError(err, "specialization", "specialization_name", in.SpecializationName))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Specialization updated successfully"})
+}
+
+func (s *server) deleteSpecialization(w http.ResponseWriter, r *http.Request) {
+	if !allowed(w, r, permEditReferences) {
+		return
+	}
+	id, err := pathID(r)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid specialization ID"))
+		return
+	}
+	refs, err := s.refs.DeleteSpecialization(r.Context(), id)
+	if err != nil {
+		writeError(w, r, referenceDeleteError(err, "Specialization", refs))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Specialization deleted successfully"})
+}
+
+// referenceWriteError reports a failed insert or update of a lookup row; the
+// name column is the only unique one.
+func referenceWriteError(err error, entity, field, name string) *APIError {
+	e := storeError(err, strings.ToUpper(entity[:1])+entity[1:])
+	if err == ErrDuplicate {
+		e.Message = fmt.Sprintf("A %s named '%s' already exists.", entity, name)
+		e.Fields = FieldErrors{{Field: field, Message: "is already taken"}}
+	}
+	return e
+}
+
+// referenceDeleteError reports a refused delete with the number of rows
+// still pointing at the record, by table.
+func referenceDeleteError(err error, entity string, refs map[string]int) *APIError {
+	e := storeError(err, entity)
+	if err == ErrInUse {
+		e.Message = fmt.Sprintf("Cannot delete the %s because other records still reference it.", strings.ToLower(entity))
+		e.References = refs
+	}
+	return e
+}
@@ -0,0 +1,53 @@
+// Loaded before the page scripts: adds the CSRF token to every state-changing
+// API request, sends the user to the login page when the session is gone and
+// puts a logout button in the navigation. The permissions of the user become
+// can-* classes of the body, which show the needs-* elements (styles.css).
+(function() {
+    const originalFetch = window.fetch.bind(window);
+
+    function csrfToken() {
+        const match = document.cookie.match(/(?:^|;\s*)medical_csrf=([^;]*)/);
+        return match ? decodeURIComponent(match[1]) : '';
+    }
+
+    function goToLogin() {
+        const next = window.location.pathname + window.location.search;
+        window.location.href = '/login.html?next=' + encodeURIComponent(next);
+    }
+
+    window.fetch = async function(input, init) {
+        init = init || {};
+        const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+        if (method !== 'GET' && method !== 'HEAD') {
+            const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+            headers.set('X-CSRF-Token', csrfToken());
+            init = Object.assign({}, init, { headers: headers });
+        }
+        const response = await originalFetch(input, init);
+        const url = new URL(input instanceof Request ? input.url : input, window.location.href);
+        if (response.status === 401 && url.origin === window.location.origin && url.pathname !== '/api/login') {
+            goToLogin();
+        }
+        return response;
+    };
+
+    async function logout() {
+        await fetch('/api/logout', { method: 'POST' });
+        goToLogin();
+    }
+
+    document.addEventListener('DOMContentLoaded', async function() {
+        const nav = document.querySelector('nav');
+        try {
+            const response = await fetch('/api/session');
+            if (!response.ok) return;
+            const session = await response.json();
+            session.permissions.forEach(p => document.body.classList.add('can-' + p.replace(/_/g, '-')));
+            const button = document.createElement('button');
+            button.className = 'nav-link logout-button';
+            button.textContent = `Log Out (${session.username})`;
+            button.addEventListener('click', logout);
+            if (nav) nav.appendChild(button);
+        } catch (error) {}
+    });
+})();
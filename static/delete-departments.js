@@ -89,26 +89,47 @@ function displayDepartments(departments) {
     });
 }
 
-// Delete department with confirmation
+// Delete department after previewing it. A department that still has
+// workers, archived ones included, is only deleted after moving them to
+// another department.
 async function deleteDepartment(departmentId, departmentName) {
-    if (!confirm(`⚠️ WARNING: This will delete the department "${departmentName}" and ALL medical workers in this department due to cascade deletion.\n\nAre you sure you want to delete this department?`)) {
-        return;
-    }
     try {
-        showMessage('Deleting department...', 'success');
-        const response = await fetch(`/api/departments/${departmentId}`, { method: 'DELETE' });
-        if (response.ok) {
-            showMessage(`Department "${departmentName}" deleted successfully!`, 'success');
-            setTimeout(() => { loadDepartments(); }, 1000);
+        const preview = async (query) => {
+            const response = await fetch(`/api/departments/${departmentId}?dry_run=true${query}`, { method: 'DELETE' });
+            return { response, result: await response.json().catch(() => ({})) };
+        };
+        let { response, result } = await preview('');
+        let reassignTo = '';
+        if (response.status === 409 && result.references) {
+            reassignTo = prompt(`The department "${departmentName}" has ${result.references.medical_workers} medical worker(s), archived ones included.\n\n` +
+                'Enter the ID of a department to move them to before deleting it.');
+            if (reassignTo === null) return;
+            reassignTo = reassignTo.trim();
+            if (!reassignTo) throw new Error('Workers must be moved to another department first.');
+            ({ response, result } = await preview(`&reassign_to=${encodeURIComponent(reassignTo)}`));
+        }
+        if (!response.ok) {
+            const fieldErrors = (result.fields || []).map(f => `${f.field} ${f.message}`).join('; ');
+            throw new Error([result.message || `Server error: ${response.status}`, fieldErrors].filter(Boolean).join(' '));
+        }
+        if (result.workers.length === 0) {
+            if (!confirm(`Delete the department "${departmentName}"? It has no medical workers.`)) return;
         } else {
-            if (response.status === 409) {
-                const errorData = await response.json();
-                throw new Error(errorData.message || 'Cannot delete department due to constraints');
-            } else {
-                const errorText = await response.text();
-                throw new Error(`Server error: ${response.status} - ${errorText}`);
-            }
+            const names = result.workers.slice(0, 10).map(w => `  - ${w.first_name} ${w.last_name}${w.deleted_at ? ' (archived)' : ''}`).join('\n');
+            const more = result.workers.length > 10 ? `\n  ...and ${result.workers.length - 10} more` : '';
+            if (!confirm(`These ${result.workers.length} medical worker(s) will be moved to department ${reassignTo}:\n${names}${more}\n\nDelete the department "${departmentName}"?`)) return;
+        }
+        showMessage('Deleting department...', 'success');
+        const query = reassignTo ? `?reassign_to=${encodeURIComponent(reassignTo)}` : '';
+        response = await fetch(`/api/departments/${departmentId}${query}`, { method: 'DELETE' });
+        result = await response.json().catch(() => ({}));
+        if (!response.ok) {
+            const fieldErrors = (result.fields || []).map(f => `${f.field} ${f.message}`).join('; ');
+            throw new Error([result.message || `Server error: ${response.status}`, fieldErrors].filter(Boolean).join(' '));
         }
+        const moved = result.workers_reassigned ? ` ${result.workers_reassigned} worker(s) moved to department ${result.reassigned_to}.` : '';
+        showMessage(`Department "${departmentName}" deleted successfully!${moved}`, 'success');
+        setTimeout(() => { loadDepartments(); }, 1000);
     } catch (error) {
         showMessage('Error deleting department: ' + error.message, 'error');
     }
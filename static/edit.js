@@ -103,11 +103,16 @@ async function searchWorker() {
     }
 }
 
+// loadedWorker is the worker as last loaded, so that a save sends only the
+// fields that were changed.
+let loadedWorker = null;
+
 async function loadWorkerForEdit(workerId) {
     try {
         const response = await fetch(`/api/medical-workers/${workerId}`);
         if (!response.ok) throw new Error(`HTTP error! status: ${response.status}`);
         const worker = await response.json();
+        loadedWorker = worker;
         document.getElementById('editWorkerId').value = worker.worker_id;
         document.getElementById('editFirstName').value = worker.first_name;
         document.getElementById('editLastName').value = worker.last_name;
@@ -134,9 +139,8 @@ async function loadWorkerForEdit(workerId) {
         document.getElementById('editLicenseNumber').value = worker.license_number;
         const currentImagePreview = document.getElementById('currentImagePreview');
         const deleteImageBtn = document.getElementById('deleteImageBtn');
-        const timestamp = new Date().getTime();
         if (worker.has_image) {
-            const imageUrl = `/api/medical-workers/${workerId}/image?t=${timestamp}`;
+            const imageUrl = worker.image_url + (worker.image_url.includes('?') ? '&' : '?') + 'size=medium';
             currentImagePreview.innerHTML = `
         <div style="margin-bottom: 10px;">
             <strong>Current Image:</strong>
@@ -177,35 +181,44 @@ document.getElementById('editWorkerForm').addEventListener('submit', async funct
         specialization_id: parseInt(document.getElementById('editSpecialization').value),
         hire_date: document.getElementById('editHireDate').value,
         salary: parseFloat(document.getElementById('editSalary').value),
-        license_number: document.getElementById('editLicenseNumber').value.trim(),
-        row_version: document.getElementById('editWorkerForm').dataset.rowVersion || ''
+        license_number: document.getElementById('editLicenseNumber').value.trim()
     };
+    const rowVersion = document.getElementById('editWorkerForm').dataset.rowVersion || '';
     const workerId = document.getElementById('editWorkerId').value;
     if (!formData.department_id || !formData.specialization_id) {
         showEditMessage('Please select both department and specialization', 'error');
         return;
     }
-    if (!formData.row_version) {
+    if (!rowVersion) {
         showEditMessage('Error: Missing version information. Please reload the worker.', 'error');
         return;
     }
+    const patch = {};
+    for (const [field, value] of Object.entries(formData)) {
+        const original = field === 'hire_date' && loadedWorker ? loadedWorker.hire_date.split('T')[0] : loadedWorker && loadedWorker[field];
+        if (value !== original) patch[field] = value;
+    }
     try {
-        const response = await fetch(`/api/medical-workers/${workerId}`, {
-            method: 'PUT',
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify(formData)
+        const response = Object.keys(patch).length === 0 ? { ok: true } : await fetch(`/api/medical-workers/${workerId}`, {
+            method: 'PATCH',
+            headers: { 'Content-Type': 'application/merge-patch+json' },
+            body: JSON.stringify({ ...patch, row_version: rowVersion })
         });
         if (!response.ok) {
             if (response.status === 409) {
                 const errorData = await response.json();
-                if (errorData.error === 'CONCURRENCY_CONFLICT') {
+                if (errorData.error === 'CONCURRENCY_CONFLICT' && errorData.current) {
+                    showEditMessage('⚠️ This record was modified by another user. Choose which values to keep.', 'error');
+                    showMergeDialog(errorData);
+                } else if (errorData.error === 'CONCURRENCY_CONFLICT') {
                     showEditMessage('⚠️ This record was modified by another user. Please reload the record and try again.', 'error');
                     if (confirm(errorData.message + '\n\nDo you want to reload the current data?')) loadWorkerForEdit(workerId);
                 } else throw new Error(errorData.message || 'Conflict occurred');
                 return;
             } else {
-                const errorText = await response.text();
-                throw new Error(`Server error: ${response.status} - ${errorText}`);
+                const errorData = await response.json().catch(() => ({}));
+                const fieldErrors = (errorData.fields || []).map(f => `${f.field} ${f.message}`).join('; ');
+                throw new Error([errorData.message || `Server error: ${response.status}`, fieldErrors].filter(Boolean).join(' '));
             }
         }
         const imageFile = document.getElementById('editImageUpload').files[0];
@@ -214,7 +227,10 @@ document.getElementById('editWorkerForm').addEventListener('submit', async funct
             const imageFormData = new FormData();
             imageFormData.append('image', imageFile);
             const imageResponse = await fetch(`/api/medical-workers/${workerId}/image`, { method: 'POST', body: imageFormData });
-            if (!imageResponse.ok) throw new Error('Failed to upload image');
+            if (!imageResponse.ok) {
+                const errorData = await imageResponse.json().catch(() => ({}));
+                throw new Error(errorData.message || 'Failed to upload image');
+            }
             imageUpdated = true;
         }
         showEditMessage('Medical worker updated successfully!', 'success');
@@ -232,6 +248,84 @@ document.getElementById('editWorkerForm').addEventListener('submit', async funct
     }
 });
 
+const mergeFieldInputs = {
+    first_name: ['First Name', 'editFirstName'],
+    last_name: ['Last Name', 'editLastName'],
+    email: ['Email', 'editEmail'],
+    phone_number: ['Phone Number', 'editPhoneNumber'],
+    department_id: ['Department', 'editDepartment'],
+    specialization_id: ['Specialization', 'editSpecialization'],
+    hire_date: ['Hire Date', 'editHireDate'],
+    salary: ['Salary', 'editSalary'],
+    license_number: ['License Number', 'editLicenseNumber']
+};
+
+function mergeDisplayValue(field, value) {
+    const input = document.getElementById(mergeFieldInputs[field][1]);
+    if (input.tagName === 'SELECT') {
+        const option = Array.from(input.options).find(o => o.value == value);
+        if (option) return option.textContent;
+    }
+    return value === '' || value === null ? '(empty)' : String(value);
+}
+
+// showMergeDialog lists the fields where the saved record differs from the
+// submitted one. The chosen values are put into the form, which is then saved
+// again against the current row_version.
+function showMergeDialog(conflict) {
+    let modal = document.getElementById('mergeModal');
+    if (!modal) {
+        modal = document.createElement('div');
+        modal.id = 'mergeModal';
+        modal.style.cssText = 'display: none; position: fixed; top: 0; left: 0; width: 100%; height: 100%; background-color: rgba(0,0,0,0.8); z-index: 1000; justify-content: center; align-items: center;';
+        document.body.appendChild(modal);
+    }
+    const rows = conflict.diff.map(d => `
+        <tr>
+            <td style="padding: 6px; font-weight: 600;">${escapeHtml(mergeFieldInputs[d.field][0])}</td>
+            <td style="padding: 6px;"><label><input type="radio" name="merge_${d.field}" value="mine" checked> ${escapeHtml(mergeDisplayValue(d.field, d.submitted))}</label></td>
+            <td style="padding: 6px;"><label><input type="radio" name="merge_${d.field}" value="theirs"> ${escapeHtml(mergeDisplayValue(d.field, d.current))}</label></td>
+        </tr>`).join('');
+    modal.innerHTML = `
+        <div style="background: white; padding: 20px; border-radius: 10px; max-width: 90%; max-height: 90%; overflow: auto;">
+            <h3>Resolve Conflicting Changes</h3>
+            <p style="margin: 10px 0;">Another user saved this worker after you loaded it. Choose the value to keep for each field that differs.</p>
+            <table style="width: 100%; border-collapse: collapse; margin-bottom: 15px;">
+                <tr><th style="text-align: left; padding: 6px;">Field</th><th style="text-align: left; padding: 6px;">Your value</th><th style="text-align: left; padding: 6px;">Saved value</th></tr>
+                ${rows}
+            </table>
+            <div style="display: flex; gap: 10px;">
+                <button type="button" class="btn-primary" id="mergeSaveBtn">Save Merged Values</button>
+                <button type="button" class="btn-danger" id="mergeDiscardBtn">Discard My Changes</button>
+            </div>
+        </div>`;
+    modal.style.display = 'flex';
+    document.getElementById('mergeSaveBtn').onclick = function() {
+        loadedWorker = conflict.current;
+        document.getElementById('editWorkerForm').dataset.rowVersion = conflict.row_version;
+        for (const [field, [, inputId]] of Object.entries(mergeFieldInputs)) {
+            const value = conflict.current[field];
+            document.getElementById(inputId).value = field === 'hire_date' ? value.split('T')[0] : value;
+        }
+        conflict.diff.forEach(d => {
+            const choice = modal.querySelector(`input[name="merge_${d.field}"]:checked`).value;
+            document.getElementById(mergeFieldInputs[d.field][1]).value = choice === 'mine' ? d.submitted : d.current;
+        });
+        modal.style.display = 'none';
+        document.getElementById('editWorkerForm').requestSubmit();
+    };
+    document.getElementById('mergeDiscardBtn').onclick = function() {
+        modal.style.display = 'none';
+        loadWorkerForEdit(conflict.current.worker_id);
+    };
+}
+
+function escapeHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
 function cancelEdit() {
     document.getElementById('editWorkerForm').reset();
     document.getElementById('editWorkerForm').style.display = 'none';
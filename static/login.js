@@ -0,0 +1,33 @@
+document.getElementById('loginForm').addEventListener('submit', async function(e) {
+    e.preventDefault();
+    const messageDiv = document.getElementById('message');
+    messageDiv.className = 'message';
+    messageDiv.textContent = '';
+    try {
+        const response = await fetch('/api/login', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                username: document.getElementById('username').value,
+                password: document.getElementById('password').value
+            })
+        });
+        if (!response.ok) {
+            const error = await response.json().catch(() => ({}));
+            throw new Error(error.message || `HTTP error! status: ${response.status}`);
+        }
+        window.location.href = safeNext(new URLSearchParams(window.location.search).get('next'));
+    } catch (error) {
+        messageDiv.className = 'message error';
+        messageDiv.textContent = error.message;
+    }
+});
+
+// safeNext only follows local paths, so that the login page cannot be used
+// to send people to another site.
+function safeNext(next) {
+    if (next && next.startsWith('/') && !next.startsWith('//') && !next.startsWith('/\\')) {
+        return next;
+    }
+    return '/';
+}
@@ -140,10 +140,15 @@ document.getElementById('workerForm').addEventListener('submit', async function(
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify(formData)
         });
-        if (!workerResponse.ok) throw new Error(`Server error: ${workerResponse.status}`);
+        if (!workerResponse.ok) {
+            const errorData = await workerResponse.json().catch(() => ({}));
+            const fieldErrors = (errorData.fields || []).map(f => `${f.field} ${f.message}`).join('; ');
+            throw new Error([errorData.message || `Server error: ${workerResponse.status}`, fieldErrors].filter(Boolean).join(' '));
+        }
         const workerResult = await workerResponse.json();
         const workerId = workerResult.worker_id;
         const imageFile = document.getElementById('imageUpload').files[0];
+        let imageError = '';
         if (imageFile) {
             try {
                 const imageFormData = new FormData();
@@ -152,10 +157,16 @@ document.getElementById('workerForm').addEventListener('submit', async function(
                     method: 'POST',
                     body: imageFormData
                 });
-                if (!imageResponse.ok) throw new Error('Failed to upload image');
-            } catch (error) {}
+                if (!imageResponse.ok) {
+                    const errorData = await imageResponse.json().catch(() => ({}));
+                    throw new Error(errorData.message || 'Failed to upload image');
+                }
+            } catch (error) {
+                imageError = error.message;
+            }
         }
-        showMessage('Medical worker added successfully!', 'success');
+        if (imageError) showMessage('Medical worker added, but the image was not saved: ' + imageError, 'error');
+        else showMessage('Medical worker added successfully!', 'success');
         document.getElementById('workerForm').reset();
         document.getElementById('hireDate').valueAsDate = new Date();
         document.getElementById('imagePreview').style.display = 'none';
@@ -36,28 +36,50 @@ async function loadSpecializations() {
     } catch (error) {}
 }
 
-async function loadWorkers() {
+let currentPage = 0;
+
+async function loadWorkers(keepPage) {
+    if (keepPage !== true) currentPage = 0;
     const departmentId = document.getElementById('filterDepartment').value;
     const specializationId = document.getElementById('filterSpecialization').value;
+    const pageSize = parseInt(document.getElementById('pageSize').value);
     let url = '/api/medical-workers';
     const params = new URLSearchParams();
     if (departmentId) params.append('department_id', departmentId);
     if (specializationId) params.append('specialization_id', specializationId);
-    if (params.toString()) url += '?' + params.toString();
+    if (document.getElementById('includeArchived').checked) params.append('include_archived', 'true');
+    params.append('sort', document.getElementById('sortWorkers').value);
+    params.append('limit', pageSize);
+    params.append('offset', currentPage * pageSize);
+    url += '?' + params.toString();
     try {
         const response = await fetch(url);
         if (!response.ok) throw new Error(`HTTP error! status: ${response.status}`);
         const workers = await response.json();
         displayWorkers(workers || []);
+        updatePagination(parseInt(response.headers.get('X-Total-Count')) || 0, pageSize);
     } catch (error) {
         const tbody = document.getElementById('workersTableBody');
         tbody.innerHTML = `<tr><td colspan="13" style="text-align: center; color: red;">Error loading workers: ${error.message}</td></tr>`;
     }
 }
 
-function getWorkerImageUrl(workerId, hasImage) {
-    if (!hasImage) return 'data:image/svg+xml;utf8,<svg xmlns="http://www.w3.org/2000/svg" width="50" height="50" viewBox="0 0 50 50"><rect width="50" height="50" fill="%23f0f0f0"/><text x="25" y="25" font-family="Arial" font-size="12" fill="%23999" text-anchor="middle" dy=".3em">No Image</text></svg>';
-    return `/api/medical-workers/${workerId}/image?t=${Date.now()}`;
+function updatePagination(total, pageSize) {
+    const pageCount = Math.max(1, Math.ceil(total / pageSize));
+    document.getElementById('pageInfo').textContent = `Page ${currentPage + 1} of ${pageCount} (${total} workers)`;
+    document.getElementById('prevPage').disabled = currentPage === 0;
+    document.getElementById('nextPage').disabled = currentPage + 1 >= pageCount;
+}
+
+function changePage(delta) {
+    currentPage = Math.max(0, currentPage + delta);
+    loadWorkers(true);
+}
+
+function getWorkerImageUrl(worker) {
+    if (!worker.has_image) return 'data:image/svg+xml;utf8,<svg xmlns="http://www.w3.org/2000/svg" width="50" height="50" viewBox="0 0 50 50"><rect width="50" height="50" fill="%23f0f0f0"/><text x="25" y="25" font-family="Arial" font-size="12" fill="%23999" text-anchor="middle" dy=".3em">No Image</text></svg>';
+    // image_url changes with the image, so the browser may cache it
+    return worker.image_url + (worker.image_url.includes('?') ? '&' : '?') + 'size=thumb';
 }
 
 function displayWorkers(workers) {
@@ -73,7 +95,7 @@ function displayWorkers(workers) {
     workersArray.forEach(worker => {
         const row = document.createElement('tr');
         const imageId = `worker-image-${worker.worker_id}`;
-        const imageUrl = getWorkerImageUrl(worker.worker_id, worker.has_image);
+        const imageUrl = getWorkerImageUrl(worker);
         let imageHtml = '';
         if (worker.has_image) {
             imageHtml = `<img id="${imageId}" 
@@ -85,6 +107,12 @@ function displayWorkers(workers) {
         } else {
             imageHtml = `<div style="width: 50px; height: 50px; background-color: #f0f0f0; border-radius: 5px; display: flex; align-items: center; justify-content: center; color: #999; font-size: 12px;">No Image</div>`;
         }
+        const actions = worker.deleted_at
+            ? `<span style="color: #999; margin-right: 5px;">Archived</span>
+                <button class="btn-primary needs-edit-workers" onclick="restoreWorker(${worker.worker_id})">Restore</button>`
+            : `<button class="btn-primary needs-edit-workers" onclick="editWorker(${worker.worker_id}, '${worker.row_version || ''}')" style="margin-right: 5px; background: linear-gradient(135deg, #10b981, #059669);">Edit</button>
+                <button class="btn-danger needs-edit-workers" onclick="deleteWorker(${worker.worker_id})">Delete</button>`;
+        if (worker.deleted_at) row.style.opacity = '0.6';
         row.innerHTML = `
             <td>${worker.worker_id}</td>
             <td style="text-align: center;">${imageHtml}</td>
@@ -96,11 +124,10 @@ function displayWorkers(workers) {
             <td>${worker.specialization_name || 'N/A'}</td>
             <td>${new Date(worker.hire_date).toLocaleDateString()}</td>
             <td>${worker.experience || 'N/A'}</td>
-            <td>$${worker.salary?.toLocaleString() || '0'}</td>
-            <td>${worker.license_number}</td>
+            <td class="needs-view-salaries">$${worker.salary?.toLocaleString() || '0'}</td>
+            <td class="needs-view-salaries">${worker.license_number || ''}</td>
             <td>
-                <button class="btn-primary" onclick="editWorker(${worker.worker_id}, '${worker.row_version || ''}')" style="margin-right: 5px; background: linear-gradient(135deg, #10b981, #059669);">Edit</button>
-                <button class="btn-danger" onclick="deleteWorker(${worker.worker_id})">Delete</button>
+                ${actions}
             </td>
         `;
         tbody.appendChild(row);
@@ -114,19 +141,32 @@ function editWorker(workerId, rowVersion) {
 }
 
 async function deleteWorker(workerId) {
-    if (!confirm('Are you sure you want to delete this medical worker?')) return;
+    if (!confirm('Are you sure you want to delete this medical worker? The record is archived and can be restored until it is purged.')) return;
     try {
         const response = await fetch(`/api/medical-workers/${workerId}`, { method: 'DELETE' });
-        if (response.ok) loadWorkers();
+        if (response.ok) loadWorkers(true);
         else {
-            const errorText = await response.text();
-            throw new Error(`Server error: ${response.status} - ${errorText}`);
+            const errorData = await response.json().catch(() => ({}));
+            throw new Error(errorData.message || `Server error: ${response.status}`);
         }
     } catch (error) {
         alert('Error deleting medical worker: ' + error.message);
     }
 }
 
+async function restoreWorker(workerId) {
+    try {
+        const response = await fetch(`/api/medical-workers/${workerId}/restore`, { method: 'POST' });
+        if (response.ok) loadWorkers(true);
+        else {
+            const errorData = await response.json().catch(() => ({}));
+            throw new Error(errorData.message || `Server error: ${response.status}`);
+        }
+    } catch (error) {
+        alert('Error restoring medical worker: ' + error.message);
+    }
+}
+
 async function downloadReport() {
     try {
         alert('Generating report... This may take a moment.');
@@ -154,4 +194,6 @@ async function downloadReport() {
 }
 
 document.getElementById('filterDepartment').addEventListener('change', loadWorkers);
-document.getElementById('filterSpecialization').addEventListener('change', loadWorkers);
\ No newline at end of file
+document.getElementById('filterSpecialization').addEventListener('change', loadWorkers);
+document.getElementById('sortWorkers').addEventListener('change', loadWorkers);
+document.getElementById('pageSize').addEventListener('change', loadWorkers);
\ No newline at end of file
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNotFound      = errors.New("record not found")
+	ErrConflict      = errors.New("record was modified concurrently")
+	ErrInUse         = errors.New("record is referenced by other records")
+	ErrBadRowVersion = errors.New("malformed row version")
+	ErrDuplicate     = errors.New("record with the same unique value exists")
+	// ErrInvalidReference means a foreign key points to a missing record.
+	ErrInvalidReference = errors.New("referenced record does not exist")
+	ErrTooLong          = errors.New("value too long for column")
+)
+
+// WorkerInput is the editable part of a medical worker.
+type WorkerInput struct {
+	FirstName        string  `json:"first_name"`
+	LastName         string  `json:"last_name"`
+	Email            string  `json:"email"`
+	PhoneNumber      string  `json:"phone_number"`
+	DepartmentID     int     `json:"department_id"`
+	SpecializationID int     `json:"specialization_id"`
+	HireDate         string  `json:"hire_date"`
+	Salary           float64 `json:"salary"`
+	LicenseNumber    string  `json:"license_number"`
+}
+
+// DepartmentInput is the editable part of a department.
+type DepartmentInput struct {
+	DepartmentName string  `json:"department_name"`
+	DepartmentHead *string `json:"department_head"`
+	Location       *string `json:"location"`
+	PhoneNumber    *string `json:"phone_number"`
+	FacilityTypeID int     `json:"facility_type_id"`
+}
+
+// FacilityTypeInput is the editable part of a facility type.
+// AccreditationRequired defaults to true like the column.
+type FacilityTypeInput struct {
+	TypeName              string  `json:"type_name"`
+	Description           *string `json:"description"`
+	TypicalBedCapacity    *int    `json:"typical_bed_capacity"`
+	AccreditationRequired *bool   `json:"accreditation_required"`
+}
+
+// SpecializationInput is the editable part of a specialization.
+// CertificationRequired defaults to true like the column.
+type SpecializationInput struct {
+	SpecializationName    string  `json:"specialization_name"`
+	Description           *string `json:"description"`
+	Category              *string `json:"category"`
+	RequiredYearsTraining *int    `json:"required_years_training"`
+	CertificationRequired *bool   `json:"certification_required"`
+}
+
+// WorkerPage is one page of a worker listing. Total counts every row matching
+// the filters, HasMore tells whether rows follow the returned ones.
+type WorkerPage struct {
+	Workers []MedicalWorker
+	Total   int
+	HasMore bool
+}
+
+// WorkerImage is the photo of a worker with its MIME type, which is empty
+// for images uploaded before the type was recorded. Stores deal in the Key of
+// the image in blob storage; Data is only set for images still kept in the
+// database and for images on their way to blob storage. Version is the Key
+// of the original, which changes every size with it, and UpdatedAt the time
+// the original was uploaded; both are empty for images uploaded before.
+type WorkerImage struct {
+	Key         string
+	ContentType string
+	Data        []byte
+	Version     string
+	UpdatedAt   time.Time
+}
+
+// ReportSheet is one sheet of the Excel report with raw driver values.
+type ReportSheet struct {
+	Name    string
+	Columns []string
+	Types   []string
+	Rows    [][]interface{}
+}
+
+// WorkerVersion is one historical state of a worker, valid from ValidFrom
+// until ValidTo, which is nil for the current state. Department and
+// specialization names are the current ones.
+type WorkerVersion struct {
+	WorkerID           int      `json:"worker_id"`
+	FirstName          string   `json:"first_name"`
+	LastName           string   `json:"last_name"`
+	Email              *string  `json:"email"`
+	PhoneNumber        *string  `json:"phone_number"`
+	DepartmentID       int      `json:"department_id"`
+	DepartmentName     *string  `json:"department_name,omitempty"`
+	SpecializationID   int      `json:"specialization_id"`
+	SpecializationName *string  `json:"specialization_name,omitempty"`
+	HireDate           string   `json:"hire_date"`
+	Salary             *float64 `json:"salary,omitempty"`
+	LicenseNumber      *string  `json:"license_number,omitempty"`
+	DeletedAt          *string  `json:"deleted_at,omitempty"`
+	ValidFrom          string   `json:"valid_from"`
+	ValidTo            *string  `json:"valid_to"`
+}
+
+// AuditEntry is one change recorded in the audit log. Before and After are
+// the record as JSON; Before is empty for creates, After for deletes.
+type AuditEntry struct {
+	AuditID    int64           `json:"audit_id"`
+	OccurredAt string          `json:"occurred_at"`
+	Actor      string          `json:"actor"`
+	RequestID  string          `json:"request_id,omitempty"`
+	Entity     string          `json:"entity"`
+	EntityID   int             `json:"entity_id"`
+	Action     string          `json:"action"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+}
+
+type WorkerStore interface {
+	ListWorkers(ctx context.Context, filters Filters, page *pageRequest) (*WorkerPage, error)
+	GetWorker(ctx context.Context, id int) (*MedicalWorker, error)
+	CreateWorker(ctx context.Context, in *WorkerInput) (int64, error)
+	// UpdateWorker returns ErrConflict when rowVersion is no longer current.
+	UpdateWorker(ctx context.Context, id int, in *WorkerInput, rowVersion string) error
+	// PatchWorker sets only the given columns, keyed by name, under the same
+	// row version guard as UpdateWorker.
+	PatchWorker(ctx context.Context, id int, columns map[string]interface{}, rowVersion string) error
+	// DeleteWorker archives a worker. It returns ErrConflict when rowVersion
+	// is set and no longer current; an empty rowVersion archives
+	// unconditionally. Archived workers are left out of listings and cannot
+	// be read or changed until restored.
+	DeleteWorker(ctx context.Context, id int, rowVersion string) error
+	// RestoreWorker brings back an archived worker; restoring an active one
+	// does nothing.
+	RestoreWorker(ctx context.Context, id int) error
+	// WorkerHistory returns every recorded state of a worker, oldest first,
+	// also after the worker was archived or purged.
+	WorkerHistory(ctx context.Context, id int) ([]WorkerVersion, error)
+	// PurgeWorkers permanently removes workers archived before the given
+	// time and returns them as they were.
+	PurgeWorkers(ctx context.Context, archivedBefore time.Time) ([]MedicalWorker, error)
+	// GetWorkerImage returns the image of a worker in a size, nil when the
+	// worker has no image or no copy in that size.
+	GetWorkerImage(ctx context.Context, id int, size string) (*WorkerImage, error)
+	// SetWorkerImage replaces the image of a worker with the given sizes,
+	// which must include the original; nil removes the image.
+	SetWorkerImage(ctx context.Context, id int, images map[string]*WorkerImage) error
+	// AddImageVariant stores a missing resized copy of the current image.
+	AddImageVariant(ctx context.Context, id int, size string, img *WorkerImage) error
+}
+
+// ImageStore moves images out of the database and tells which blobs are in
+// use.
+type ImageStore interface {
+	// MoveImages passes every image still kept in the database to put,
+	// which stores it and returns its key, and returns how many were moved.
+	MoveImages(ctx context.Context, put func(img *WorkerImage) (string, error)) (int, error)
+	// ImageKeys returns the keys of every image and resized copy.
+	ImageKeys(ctx context.Context) (map[string]bool, error)
+}
+
+type DepartmentStore interface {
+	ListDepartments(ctx context.Context, filters Filters) ([]Department, error)
+	GetDepartment(ctx context.Context, id int) (*Department, error)
+	// CreateDepartment and UpdateDepartment return ErrDuplicate for a taken
+	// name and ErrInvalidReference for an unknown facility type.
+	CreateDepartment(ctx context.Context, in *DepartmentInput) (int64, error)
+	// UpdateDepartment returns ErrConflict when rowVersion is no longer current.
+	UpdateDepartment(ctx context.Context, id int, in *DepartmentInput, rowVersion string) error
+	// DeleteDepartment removes a department and returns the workers it had,
+	// archived ones included, after moving them to the department
+	// reassignTo. Workers are never deleted with their department: without
+	// reassignTo a department that has any is ErrInUse, returned with them.
+	// An unknown target, or the department itself, is ErrInvalidReference.
+	// With dryRun the checks run without writing anything.
+	DeleteDepartment(ctx context.Context, id, reassignTo int, dryRun bool) ([]MedicalWorker, error)
+}
+
+// ReferenceStore manages the facility type and specialization lookup tables.
+// Create and Update return ErrDuplicate for a taken name. Delete returns
+// ErrInUse together with the number of referencing rows by table.
+type ReferenceStore interface {
+	ListFacilityTypes(ctx context.Context, filters Filters) ([]FacilityType, error)
+	GetFacilityType(ctx context.Context, id int) (*FacilityType, error)
+	CreateFacilityType(ctx context.Context, in *FacilityTypeInput) (int64, error)
+	UpdateFacilityType(ctx context.Context, id int, in *FacilityTypeInput) error
+	DeleteFacilityType(ctx context.Context, id int) (map[string]int, error)
+
+	ListSpecializations(ctx context.Context, filters Filters) ([]Specialization, error)
+	GetSpecialization(ctx context.Context, id int) (*Specialization, error)
+	CreateSpecialization(ctx context.Context, in *SpecializationInput) (int64, error)
+	UpdateSpecialization(ctx context.Context, id int, in *SpecializationInput) error
+	DeleteSpecialization(ctx context.Context, id int) (map[string]int, error)
+}
+
+type ReportStore interface {
+	ReportSheets(ctx context.Context) ([]ReportSheet, error)
+	// DepartmentStatistics runs sp_GetDepartmentStatistics, optionally
+	// filtered by the "department_id" and "facility_type_id" filters.
+	DepartmentStatistics(ctx context.Context, filters Filters) ([]DepartmentStat, error)
+}
+
+// TxStore runs store calls in one transaction: those fn makes with the
+// context it is given succeed or fail together.
+type TxStore interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type AuditStore interface {
+	RecordAudit(ctx context.Context, e *AuditEntry) error
+	// ListAudit returns the entries matching the filters, newest first, and
+	// the number of all matching entries.
+	ListAudit(ctx context.Context, filters Filters) ([]AuditEntry, int, error)
+}
+
+// User is an account of the web UI and API.
+type User struct {
+	UserID       int    `json:"user_id"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	PasswordHash string `json:"-"`
+}
+
+// Session is a login session. ID is the hash of the token in the session
+// cookie, never the token itself.
+// Role and DepartmentIDs are those of the user. A request authenticated
+// with an API token has a session with TokenID and Scopes set instead of ID
+// and CSRFToken.
+type Session struct {
+	ID            string
+	UserID        int
+	Username      string
+	Role          string
+	DepartmentIDs []int
+	CSRFToken     string
+	ExpiresAt     string
+	TokenID       int64
+	Scopes        []string
+}
+
+type UserStore interface {
+	// CreateUser returns ErrDuplicate for a taken username and
+	// ErrInvalidReference for an unknown department.
+	CreateUser(ctx context.Context, username, passwordHash, role string, departments []int) (int64, error)
+	// SetRole replaces the role and the departments of a user.
+	SetRole(ctx context.Context, username, role string, departments []int) error
+	// SetPassword changes the password of a user and ends their sessions.
+	SetPassword(ctx context.Context, username, passwordHash string) error
+	GetUserByName(ctx context.Context, username string) (*User, error)
+	CountUsers(ctx context.Context) (int, error)
+	// CreateSession stores a new session and drops the expired ones.
+	CreateSession(ctx context.Context, sess *Session) error
+	// GetSession returns the session with the given id unless it has expired
+	// by now, ErrNotFound otherwise.
+	GetSession(ctx context.Context, id string, now time.Time) (*Session, error)
+	DeleteSession(ctx context.Context, id string) error
+}
+
+// APIToken is a token other systems authenticate with. Hash is the SHA-256
+// of the token, which itself is only shown when it is created.
+type APIToken struct {
+	TokenID    int64    `json:"token_id"`
+	UserID     int      `json:"user_id"`
+	Username   string   `json:"username"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	RevokedAt  *string  `json:"revoked_at,omitempty"`
+	Hash       string   `json:"-"`
+}
+
+type TokenStore interface {
+	CreateAPIToken(ctx context.Context, t *APIToken) (int64, error)
+	// ListAPITokens returns the tokens of a user, or of everyone for userID
+	// 0, newest first.
+	ListAPITokens(ctx context.Context, userID int) ([]APIToken, error)
+	// RevokeAPIToken revokes a token of the user, or of anyone for userID 0.
+	// Unknown and already revoked tokens are ErrNotFound.
+	RevokeAPIToken(ctx context.Context, id int64, userID int) error
+	// TokenSession returns the session of a valid token with the given hash
+	// and records that the token was used, ErrNotFound for unknown, expired
+	// and revoked tokens.
+	TokenSession(ctx context.Context, hash string, now time.Time) (*Session, error)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+type mssqlDialect struct{}
+
+func newMSSQLStore(db *sql.DB) *sqlStore {
+	return &sqlStore{db: db, d: mssqlDialect{}}
+}
+
+func (mssqlDialect) bindArgs(args []interface{}) []interface{} {
+	return args
+}
+
+func (mssqlDialect) workerExperience(hireDate string) string {
+	return "dbo.fn_GetWorkerExperience(" + hireDate + ")"
+}
+
+func (mssqlDialect) limitOffset(qb *queryBuilder, limit, offset int) string {
+	return " OFFSET " + qb.bind(offset) + " ROWS FETCH NEXT " + qb.bind(limit) + " ROWS ONLY"
+}
+
+func (mssqlDialect) returningID(insert, idColumn string) string {
+	return insert + "; SELECT SCOPE_IDENTITY();"
+}
+
+func (mssqlDialect) rowVersionArg(rowVersion string) (interface{}, error) {
+	return hexToVarbinary(rowVersion)
+}
+
+func (mssqlDialect) rowVersionText(column string) string {
+	return "CONVERT(VARCHAR(20), CONVERT(VARBINARY(8), " + column + "), 1)"
+}
+
+// isForeignKeyError matches error 547, raised both for a missing referenced
+// row ("FOREIGN KEY constraint") and for deleting a referenced one
+// ("REFERENCE constraint"). CHECK constraints share the number; the only one,
+// on users.role, is never violated past validation.
+func (mssqlDialect) isForeignKeyError(err error) bool {
+	return hasErrorNumber(err, 547)
+}
+
+// isUniqueError matches errors 2627 (unique constraint) and 2601 (unique index).
+func (mssqlDialect) isUniqueError(err error) bool {
+	return hasErrorNumber(err, 2627, 2601)
+}
+
+// isTruncationError matches "String or binary data would be truncated", which
+// is 8152 before SQL Server 2019 and 2628 after.
+func (mssqlDialect) isTruncationError(err error) bool {
+	return hasErrorNumber(err, 8152, 2628)
+}
+
+func hasErrorNumber(err error, numbers ...int32) bool {
+	var sqlErr mssql.Error
+	if !errors.As(err, &sqlErr) {
+		return false
+	}
+	for _, n := range numbers {
+		if sqlErr.Number == n {
+			return true
+		}
+	}
+	return false
+}
+
+func (mssqlDialect) departmentStatistics() string {
+	return "EXEC dbo.sp_GetDepartmentStatistics @department_id = @p1, @facility_type_id = @p2"
+}
+
+func (mssqlDialect) migrationsTable() string {
+	return `IF OBJECT_ID('schema_migrations', 'U') IS NULL
+CREATE TABLE schema_migrations (
+    version INT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at DATETIME2 NOT NULL DEFAULT GETDATE()
+)`
+}
+
+func (mssqlDialect) migrationForeignKeys() (off, on, check string) {
+	return "", "", ""
+}
+
+func hexToVarbinary(hexStr string) (interface{}, error) {
+	hexStr = strings.TrimPrefix(hexStr, "0x")
+	if hexStr == "" {
+		return nil, nil
+	}
+	bytes, err := hex.DecodeString(hexStr)
+	if err != nil {
+		return nil, err
+	}
+	return bytes, nil
+}
+
+func (mssqlDialect) reportQueries() []reportQuery {
+	return []reportQuery{
+		{
+			name:  "Facility Types",
+			query: "SELECT facility_type_id, type_name, description, typical_bed_capacity, accreditation_required FROM facility_types ORDER BY facility_type_id",
+		},
+		{
+			name:  "Departments",
+			query: "SELECT department_id, department_name, department_head, location, phone_number, facility_type_id, created_date FROM departments ORDER BY department_id",
+		},
+		{
+			name:  "Specializations",
+			query: "SELECT specialization_id, specialization_name, description, category, required_years_training, certification_required FROM specializations ORDER BY specialization_id",
+		},
+		{
+			name:  "Medical Workers",
+			query: "SELECT worker_id, first_name, last_name, email, phone_number, department_id, specialization_id, hire_date, salary, license_number, image_key, image_type, created_date, row_version, deleted_at FROM medical_workers ORDER BY worker_id",
+		},
+		{
+			name:  "Medical Workers View",
+			query: "SELECT worker_id, first_name, last_name, email, phone_number, department_id, department_name, specialization_id, specialization_name, hire_date, salary, license_number, has_image, row_version FROM vw_MedicalWorkers_Detailed WHERE deleted_at IS NULL ORDER BY worker_id",
+		},
+		{
+			name:  "Department Statistics",
+			query: "EXEC dbo.sp_GetDepartmentStatistics",
+		},
+	}
+}
@@ -0,0 +1,1320 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sqlDialect captures what differs between the SQL backends. Queries are
+// written with @pN placeholders and otherwise portable SQL.
+type sqlDialect interface {
+	// bindArgs adapts positional @pN arguments to what the driver expects.
+	bindArgs(args []interface{}) []interface{}
+	workerExperience(hireDate string) string
+	limitOffset(qb *queryBuilder, limit, offset int) string
+	// returningID makes an INSERT statement yield the generated key.
+	returningID(insert, idColumn string) string
+	rowVersionArg(rowVersion string) (interface{}, error)
+	// rowVersionText renders a row version column as the 0x-prefixed hex
+	// string that rowVersionArg accepts back.
+	rowVersionText(column string) string
+	isForeignKeyError(err error) bool
+	isUniqueError(err error) bool
+	isTruncationError(err error) bool
+	reportQueries() []reportQuery
+	// departmentStatistics returns the rows of sp_GetDepartmentStatistics,
+	// filtered by the nullable department id @p1 and facility type id @p2.
+	departmentStatistics() string
+	// migrationsTable creates schema_migrations if it does not exist.
+	migrationsTable() string
+	// migrationForeignKeys returns the statements that turn foreign key
+	// enforcement off and on for a connection and list the violations, empty
+	// when migrations run with it. SQLite needs it off to rebuild a table.
+	migrationForeignKeys() (off, on, check string)
+}
+
+type reportQuery struct {
+	name  string
+	query string
+}
+
+// sqlStore implements every store interface on top of database/sql.
+type sqlStore struct {
+	db *sql.DB
+	d  sqlDialect
+}
+
+func (s *sqlStore) args(args ...interface{}) []interface{} {
+	return s.d.bindArgs(args)
+}
+
+// sqlConn is what *sql.DB and *sql.Tx have in common.
+type sqlConn interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type txKey struct{}
+
+// conn returns the transaction started by InTx for ctx, or the database.
+func (s *sqlStore) conn(ctx context.Context) sqlConn {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return s.db
+}
+
+// InTx runs fn in a transaction that every store call made with the context
+// passed to fn takes part in; it commits when fn succeeds. Inside another
+// InTx, fn joins the outer transaction. Rows read stay locked until the end
+// where the database supports it, so that they cannot change in between.
+func (s *sqlStore) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.conn(ctx).QueryContext(ctx, query, s.d.bindArgs(args)...)
+}
+
+func (s *sqlStore) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.conn(ctx).QueryRowContext(ctx, query, s.d.bindArgs(args)...)
+}
+
+func (s *sqlStore) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.conn(ctx).ExecContext(ctx, query, s.d.bindArgs(args)...)
+}
+
+// workerColumns is the column list shared by every worker read from
+// vw_MedicalWorkers_Detailed, in the order expected by scanWorker.
+func (s *sqlStore) workerColumns() string {
+	return `
+	worker_id, first_name, last_name, email, phone_number,
+	department_id, department_name,
+	specialization_id, specialization_name,
+	hire_date, salary, license_number,
+	has_image, image_key,
+	row_version, deleted_at,
+	` + s.d.workerExperience("hire_date") + ` as experience`
+}
+
+// departmentColumns is the column list expected by scanDepartment, for
+// departments d joined with facility_types ft.
+func (s *sqlStore) departmentColumns() string {
+	return `
+	d.department_id, d.department_name, d.department_head, d.location, d.phone_number,
+	d.facility_type_id, ft.type_name, d.created_date, ` + s.d.rowVersionText("d.row_version")
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWorker(row rowScanner) (*MedicalWorker, error) {
+	var mw MedicalWorker
+	var imageKey sql.NullString
+	err := row.Scan(
+		&mw.WorkerID, &mw.FirstName, &mw.LastName, &mw.Email, &mw.PhoneNumber,
+		&mw.DepartmentID, &mw.DepartmentName,
+		&mw.SpecializationID, &mw.SpecializationName,
+		&mw.HireDate, &mw.Salary, &mw.LicenseNumber,
+		&mw.HasImage, &imageKey,
+		&mw.RowVersion, &mw.DeletedAt,
+		&mw.Experience,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if mw.HasImage {
+		mw.ImageURL = workerImageURL(mw.WorkerID, imageKey.String)
+	}
+	return &mw, nil
+}
+
+func scanDepartment(row rowScanner) (*Department, error) {
+	var d Department
+	var facilityTypeName sql.NullString
+	err := row.Scan(&d.DepartmentID, &d.DepartmentName, &d.DepartmentHead, &d.Location,
+		&d.PhoneNumber, &d.FacilityTypeID, &facilityTypeName, &d.CreatedDate, &d.RowVersion)
+	if err != nil {
+		return nil, err
+	}
+	d.FacilityTypeName = facilityTypeName.String
+	return &d, nil
+}
+
+func (s *sqlStore) ListWorkers(ctx context.Context, filters Filters, page *pageRequest) (*WorkerPage, error) {
+	qb := &queryBuilder{}
+	qb.applyFilters(filters, workerFilterConds)
+	qb.inDepartments(filters, "department_id")
+	if archived, _ := filters["include_archived"].(bool); !archived {
+		qb.conditions = append(qb.conditions, "deleted_at IS NULL")
+	}
+	source := "vw_MedicalWorkers_Detailed"
+	if asOf, ok := filters["as_of"]; ok {
+		source = workersAsOf(qb, asOf)
+	}
+	result := &WorkerPage{Workers: []MedicalWorker{}}
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM "+source+qb.whereClause(), qb.args...).Scan(&result.Total)
+	if err != nil {
+		return nil, err
+	}
+	page.seekAfter(qb)
+	query := "SELECT " + s.workerColumns() + " FROM " + source + qb.whereClause() + page.orderBy()
+	if page.limit > 0 {
+		query += s.d.limitOffset(qb, page.limit+1, page.offset)
+	}
+	rows, err := s.query(ctx, query, qb.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		mw, err := scanWorker(rows)
+		if err != nil {
+			log.Printf("Error scanning worker: %v", err)
+			continue
+		}
+		result.Workers = append(result.Workers, *mw)
+	}
+	if page.limit > 0 && len(result.Workers) > page.limit {
+		result.Workers = result.Workers[:page.limit]
+		result.HasMore = true
+	}
+	return result, rows.Err()
+}
+
+// workersAsOf is a stand-in for vw_MedicalWorkers_Detailed with the workers
+// employed at the given time, from medical_workers_history. Row versions are
+// empty as the rows cannot be updated.
+func workersAsOf(qb *queryBuilder, asOf interface{}) string {
+	at := qb.bind(asOf)
+	return `(SELECT h.worker_id, h.first_name, h.last_name, h.email, h.phone_number,
+		h.department_id, d.department_name, h.specialization_id, s.specialization_name,
+		h.hire_date, h.salary, h.license_number,
+		CASE WHEN mw.image_key IS NULL AND mw.image_data IS NULL THEN 0 ELSE 1 END as has_image,
+		mw.image_key, '' as row_version, h.deleted_at
+	FROM medical_workers_history h
+		LEFT JOIN departments d ON h.department_id = d.department_id
+		LEFT JOIN specializations s ON h.specialization_id = s.specialization_id
+		LEFT JOIN medical_workers mw ON h.worker_id = mw.worker_id
+	WHERE h.valid_from < ` + at + ` AND (h.valid_to IS NULL OR h.valid_to >= ` + at + `)
+		AND h.hire_date < ` + at + `) w`
+}
+
+func (s *sqlStore) WorkerHistory(ctx context.Context, id int) ([]WorkerVersion, error) {
+	rows, err := s.query(ctx, `SELECT h.worker_id, h.first_name, h.last_name, h.email, h.phone_number,
+		h.department_id, d.department_name, h.specialization_id, s.specialization_name,
+		h.hire_date, h.salary, h.license_number, h.deleted_at, h.valid_from, h.valid_to
+	FROM medical_workers_history h
+		LEFT JOIN departments d ON h.department_id = d.department_id
+		LEFT JOIN specializations s ON h.specialization_id = s.specialization_id
+	WHERE h.worker_id = @p1
+	ORDER BY h.valid_from, h.history_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var versions []WorkerVersion
+	for rows.Next() {
+		var v WorkerVersion
+		if err := rows.Scan(&v.WorkerID, &v.FirstName, &v.LastName, &v.Email, &v.PhoneNumber,
+			&v.DepartmentID, &v.DepartmentName, &v.SpecializationID, &v.SpecializationName,
+			&v.HireDate, &v.Salary, &v.LicenseNumber, &v.DeletedAt, &v.ValidFrom, &v.ValidTo); err != nil {
+			return nil, err
+		}
+		v.ValidFrom = historyTime(v.ValidFrom)
+		if v.ValidTo != nil {
+			validTo := historyTime(*v.ValidTo)
+			v.ValidTo = &validTo
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	return versions, nil
+}
+
+// historyTime returns a bound of a worker version in RFC 3339 with
+// milliseconds. The first version starts at the hire date, later bounds are
+// trigger times: SQLite stores them as text and SQL Server returns RFC 3339.
+func historyTime(s string) string {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+		}
+	}
+	return s
+}
+
+func (s *sqlStore) GetWorker(ctx context.Context, id int) (*MedicalWorker, error) {
+	row := s.queryRow(ctx, "SELECT "+s.workerColumns()+" FROM vw_MedicalWorkers_Detailed WHERE worker_id = @p1 AND deleted_at IS NULL", id)
+	mw, err := scanWorker(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return mw, err
+}
+
+func (s *sqlStore) CreateWorker(ctx context.Context, in *WorkerInput) (int64, error) {
+	query := s.d.returningID(`INSERT INTO medical_workers
+		(first_name, last_name, email, phone_number, department_id, specialization_id, hire_date, salary, license_number)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8, @p9)`, "worker_id")
+	var newWorkerID int64
+	err := s.queryRow(ctx, query,
+		in.FirstName, in.LastName, in.Email, in.PhoneNumber,
+		in.DepartmentID, in.SpecializationID, in.HireDate, in.Salary, in.LicenseNumber).Scan(&newWorkerID)
+	return newWorkerID, s.constraintError(err)
+}
+
+func (s *sqlStore) UpdateWorker(ctx context.Context, id int, in *WorkerInput, rowVersion string) error {
+	rowVersionArg, err := s.d.rowVersionArg(rowVersion)
+	if err != nil {
+		return ErrBadRowVersion
+	}
+	query := `UPDATE medical_workers
+		SET first_name = @p1,
+			last_name = @p2,
+			email = @p3,
+			phone_number = @p4,
+			department_id = @p5,
+			specialization_id = @p6,
+			hire_date = @p7,
+			salary = @p8,
+			license_number = @p9
+		WHERE worker_id = @p10
+		AND row_version = @p11
+		AND deleted_at IS NULL`
+	result, err := s.exec(ctx, query,
+		in.FirstName, in.LastName, in.Email, in.PhoneNumber,
+		in.DepartmentID, in.SpecializationID, in.HireDate,
+		in.Salary, in.LicenseNumber, id, rowVersionArg)
+	if err != nil {
+		return s.constraintError(err)
+	}
+	return s.checkVersionedUpdate(ctx, result, activeWorkerExists, id)
+}
+
+func (s *sqlStore) PatchWorker(ctx context.Context, id int, columns map[string]interface{}, rowVersion string) error {
+	rowVersionArg, err := s.d.rowVersionArg(rowVersion)
+	if err != nil {
+		return ErrBadRowVersion
+	}
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		if !workerPatchFields[name] {
+			return fmt.Errorf("column %q cannot be patched", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	qb := &queryBuilder{}
+	sets := make([]string, len(names))
+	for i, name := range names {
+		sets[i] = name + " = " + qb.bind(columns[name])
+	}
+	query := "UPDATE medical_workers SET " + strings.Join(sets, ", ") +
+		" WHERE worker_id = " + qb.bind(id) + " AND row_version = " + qb.bind(rowVersionArg) + " AND deleted_at IS NULL"
+	result, err := s.exec(ctx, query, qb.args...)
+	if err != nil {
+		return s.constraintError(err)
+	}
+	return s.checkVersionedUpdate(ctx, result, activeWorkerExists, id)
+}
+
+// checkVersionedUpdate tells apart, for an UPDATE guarded by row_version that
+// matched no rows, a record that is gone from one changed by someone else.
+func (s *sqlStore) checkVersionedUpdate(ctx context.Context, result sql.Result, existsQuery string, id int) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		var exists bool
+		err = s.queryRow(ctx, existsQuery, id).Scan(&exists)
+		if err == sql.ErrNoRows || !exists {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+// activeWorkerExists is the existence check of versioned worker updates;
+// archived workers cannot be changed.
+const activeWorkerExists = "SELECT 1 FROM medical_workers WHERE worker_id = @p1 AND deleted_at IS NULL"
+
+// dbTime formats a time for DATETIME2 and SQLite TEXT columns alike.
+func dbTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// parseDBTime reads back a time written with dbTime, which SQL Server
+// returns in RFC 3339.
+func parseDBTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02 15:04:05", s)
+}
+
+// DeleteWorker archives the worker; PurgeWorkers removes it later.
+func (s *sqlStore) DeleteWorker(ctx context.Context, id int, rowVersion string) error {
+	query := "UPDATE medical_workers SET deleted_at = @p2 WHERE worker_id = @p1 AND deleted_at IS NULL"
+	args := []interface{}{id, dbTime(time.Now())}
+	if rowVersion != "" {
+		rowVersionArg, err := s.d.rowVersionArg(rowVersion)
+		if err != nil {
+			return ErrBadRowVersion
+		}
+		query += " AND row_version = @p3"
+		args = append(args, rowVersionArg)
+	}
+	result, err := s.exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if rowVersion != "" {
+		return s.checkVersionedUpdate(ctx, result, activeWorkerExists, id)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *sqlStore) RestoreWorker(ctx context.Context, id int) error {
+	result, err := s.exec(ctx, "UPDATE medical_workers SET deleted_at = NULL WHERE worker_id = @p1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n > 0 {
+		return err
+	}
+	var exists bool
+	if err := s.queryRow(ctx, "SELECT 1 FROM medical_workers WHERE worker_id = @p1", id).Scan(&exists); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *sqlStore) PurgeWorkers(ctx context.Context, archivedBefore time.Time) (workers []MedicalWorker, err error) {
+	err = s.InTx(ctx, func(ctx context.Context) error {
+		rows, err := s.query(ctx, "SELECT "+s.workerColumns()+" FROM vw_MedicalWorkers_Detailed WHERE deleted_at < @p1 ORDER BY worker_id", dbTime(archivedBefore))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			mw, err := scanWorker(rows)
+			if err != nil {
+				return err
+			}
+			workers = append(workers, *mw)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+		_, err = s.exec(ctx, "DELETE FROM medical_workers WHERE deleted_at < @p1", dbTime(archivedBefore))
+		return err
+	})
+	return workers, err
+}
+
+func (s *sqlStore) GetWorkerImage(ctx context.Context, id int, size string) (*WorkerImage, error) {
+	var img WorkerImage
+	var key, contentType, version, updatedAt sql.NullString
+	var err error
+	if size == imageOriginal {
+		err = s.queryRow(ctx, `SELECT image_key, image_type, image_data, image_key, image_updated_at FROM medical_workers
+			WHERE worker_id = @p1 AND deleted_at IS NULL`, id).
+			Scan(&key, &contentType, &img.Data, &version, &updatedAt)
+		if err == sql.ErrNoRows {
+			return nil, ErrNotFound
+		}
+	} else {
+		err = s.queryRow(ctx, `SELECT v.image_key, v.image_type, mw.image_key, mw.image_updated_at FROM worker_image_variants v
+			JOIN medical_workers mw ON v.worker_id = mw.worker_id
+			WHERE v.worker_id = @p1 AND v.variant = @p2 AND mw.deleted_at IS NULL`, id, size).
+			Scan(&key, &contentType, &version, &updatedAt)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+	}
+	if err != nil || (!key.Valid && len(img.Data) == 0) {
+		return nil, err
+	}
+	img.Key, img.ContentType, img.Version = key.String, contentType.String, version.String
+	if updatedAt.Valid {
+		if img.UpdatedAt, err = parseDBTime(updatedAt.String); err != nil {
+			return nil, err
+		}
+	}
+	return &img, nil
+}
+
+func (s *sqlStore) SetWorkerImage(ctx context.Context, id int, images map[string]*WorkerImage) error {
+	var key, contentType, updatedAt *string
+	if original := images[imageOriginal]; original != nil {
+		now := dbTime(time.Now())
+		key, contentType, updatedAt = &original.Key, &original.ContentType, &now
+	}
+	return s.InTx(ctx, func(ctx context.Context) error {
+		result, err := s.exec(ctx, `UPDATE medical_workers SET image_key = @p1, image_type = @p2, image_updated_at = @p3, image_data = NULL
+			WHERE worker_id = @p4 AND deleted_at IS NULL`, key, contentType, updatedAt, id)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			if err == nil {
+				err = ErrNotFound
+			}
+			return err
+		}
+		if _, err := s.exec(ctx, "DELETE FROM worker_image_variants WHERE worker_id = @p1", id); err != nil {
+			return err
+		}
+		for size, img := range images {
+			if size == imageOriginal {
+				continue
+			}
+			_, err := s.exec(ctx, "INSERT INTO worker_image_variants (worker_id, variant, image_key, image_type) VALUES (@p1, @p2, @p3, @p4)",
+				id, size, img.Key, img.ContentType)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AddImageVariant ignores a copy added meanwhile by another request and a
+// worker removed meanwhile.
+func (s *sqlStore) AddImageVariant(ctx context.Context, id int, size string, img *WorkerImage) error {
+	_, err := s.exec(ctx, "INSERT INTO worker_image_variants (worker_id, variant, image_key, image_type) VALUES (@p1, @p2, @p3, @p4)",
+		id, size, img.Key, img.ContentType)
+	if err != nil && (s.d.isUniqueError(err) || s.d.isForeignKeyError(err)) {
+		return nil
+	}
+	return err
+}
+
+// MoveImages reads the images one at a time, archived workers included. An
+// image replaced meanwhile by an upload is left alone.
+func (s *sqlStore) MoveImages(ctx context.Context, put func(img *WorkerImage) (string, error)) (int, error) {
+	rows, err := s.query(ctx, "SELECT worker_id FROM medical_workers WHERE image_data IS NOT NULL ORDER BY worker_id")
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	moved := 0
+	for _, id := range ids {
+		var img WorkerImage
+		var contentType sql.NullString
+		err := s.queryRow(ctx, "SELECT image_data, image_type FROM medical_workers WHERE worker_id = @p1 AND image_data IS NOT NULL", id).
+			Scan(&img.Data, &contentType)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return moved, err
+		}
+		img.ContentType = contentType.String
+		key, err := put(&img)
+		if err != nil {
+			return moved, err
+		}
+		result, err := s.exec(ctx, `UPDATE medical_workers SET image_key = @p1, image_type = @p2, image_data = NULL
+			WHERE worker_id = @p3 AND image_data IS NOT NULL`, key, img.ContentType, id)
+		if err != nil {
+			return moved, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func (s *sqlStore) ImageKeys(ctx context.Context) (map[string]bool, error) {
+	rows, err := s.query(ctx, `SELECT image_key FROM medical_workers WHERE image_key IS NOT NULL
+		UNION SELECT image_key FROM worker_image_variants`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys[key] = true
+	}
+	return keys, rows.Err()
+}
+
+func (s *sqlStore) ListDepartments(ctx context.Context, filters Filters) ([]Department, error) {
+	qb := &queryBuilder{}
+	qb.applyFilters(filters, departmentFilterConds)
+	qb.inDepartments(filters, "d.department_id")
+	query := "SELECT " + s.departmentColumns() + " FROM departments d LEFT JOIN facility_types ft ON d.facility_type_id = ft.facility_type_id" +
+		qb.whereClause() + " ORDER BY d.department_name"
+	rows, err := s.query(ctx, query, qb.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	departments := []Department{}
+	for rows.Next() {
+		d, err := scanDepartment(rows)
+		if err != nil {
+			log.Printf("Error scanning department: %v", err)
+			continue
+		}
+		departments = append(departments, *d)
+	}
+	return departments, rows.Err()
+}
+
+func (s *sqlStore) GetDepartment(ctx context.Context, id int) (*Department, error) {
+	query := "SELECT " + s.departmentColumns() + " FROM departments d LEFT JOIN facility_types ft ON d.facility_type_id = ft.facility_type_id WHERE d.department_id = @p1"
+	d, err := scanDepartment(s.queryRow(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return d, err
+}
+
+func (s *sqlStore) CreateDepartment(ctx context.Context, in *DepartmentInput) (int64, error) {
+	query := s.d.returningID(`INSERT INTO departments
+		(department_name, department_head, location, phone_number, facility_type_id)
+		VALUES (@p1, @p2, @p3, @p4, @p5)`, "department_id")
+	var newDepartmentID int64
+	err := s.queryRow(ctx, query,
+		in.DepartmentName, in.DepartmentHead, in.Location, in.PhoneNumber, in.FacilityTypeID).Scan(&newDepartmentID)
+	return newDepartmentID, s.constraintError(err)
+}
+
+func (s *sqlStore) UpdateDepartment(ctx context.Context, id int, in *DepartmentInput, rowVersion string) error {
+	rowVersionArg, err := s.d.rowVersionArg(rowVersion)
+	if err != nil {
+		return ErrBadRowVersion
+	}
+	query := `UPDATE departments
+		SET department_name = @p1,
+			department_head = @p2,
+			location = @p3,
+			phone_number = @p4,
+			facility_type_id = @p5
+		WHERE department_id = @p6
+		AND row_version = @p7`
+	result, err := s.exec(ctx, query,
+		in.DepartmentName, in.DepartmentHead, in.Location, in.PhoneNumber, in.FacilityTypeID,
+		id, rowVersionArg)
+	if err != nil {
+		return s.constraintError(err)
+	}
+	return s.checkVersionedUpdate(ctx, result, "SELECT 1 FROM departments WHERE department_id = @p1", id)
+}
+
+// constraintError maps constraint violations of an insert or update to the
+// store errors.
+func (s *sqlStore) constraintError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case s.d.isUniqueError(err):
+		return ErrDuplicate
+	case s.d.isForeignKeyError(err):
+		return ErrInvalidReference
+	case s.d.isTruncationError(err):
+		return ErrTooLong
+	}
+	return err
+}
+
+func (s *sqlStore) DeleteDepartment(ctx context.Context, id, reassignTo int, dryRun bool) ([]MedicalWorker, error) {
+	if dryRun {
+		return s.departmentDeletion(ctx, id, reassignTo)
+	}
+	var workers []MedicalWorker
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		if workers, err = s.departmentDeletion(ctx, id, reassignTo); err != nil {
+			return err
+		}
+		if reassignTo != 0 {
+			_, err = s.exec(ctx, "UPDATE medical_workers SET department_id = @p1 WHERE department_id = @p2", reassignTo, id)
+			if err != nil {
+				return s.constraintError(err)
+			}
+		}
+		result, err := s.exec(ctx, "DELETE FROM departments WHERE department_id = @p1", id)
+		if err != nil {
+			if s.d.isForeignKeyError(err) {
+				return ErrInUse
+			}
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil && err != ErrInUse {
+		return nil, err
+	}
+	return workers, err
+}
+
+// departmentDeletion checks that a department can be deleted, with its
+// workers moved to reassignTo, and returns the workers. It only reads, so
+// that a dry run takes no locks and fires no triggers.
+func (s *sqlStore) departmentDeletion(ctx context.Context, id, reassignTo int) ([]MedicalWorker, error) {
+	var one int
+	err := s.queryRow(ctx, "SELECT 1 FROM departments WHERE department_id = @p1", id).Scan(&one)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if reassignTo != 0 {
+		if reassignTo == id {
+			return nil, ErrInvalidReference
+		}
+		err := s.queryRow(ctx, "SELECT 1 FROM departments WHERE department_id = @p1", reassignTo).Scan(&one)
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidReference
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	rows, err := s.query(ctx, "SELECT "+s.workerColumns()+" FROM vw_MedicalWorkers_Detailed WHERE department_id = @p1 ORDER BY last_name, first_name, worker_id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	workers := []MedicalWorker{}
+	for rows.Next() {
+		mw, err := scanWorker(rows)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, *mw)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if reassignTo == 0 && len(workers) > 0 {
+		return workers, ErrInUse
+	}
+	return workers, nil
+}
+
+const (
+	facilityTypeColumns   = "facility_type_id, type_name, description, typical_bed_capacity, accreditation_required"
+	specializationColumns = "specialization_id, specialization_name, description, category, required_years_training, certification_required"
+)
+
+func scanFacilityType(row rowScanner) (*FacilityType, error) {
+	var ft FacilityType
+	err := row.Scan(&ft.FacilityTypeID, &ft.TypeName, &ft.Description, &ft.TypicalBedCapacity, &ft.AccreditationRequired)
+	if err != nil {
+		return nil, err
+	}
+	return &ft, nil
+}
+
+func scanSpecialization(row rowScanner) (*Specialization, error) {
+	var sp Specialization
+	err := row.Scan(&sp.SpecializationID, &sp.SpecializationName, &sp.Description, &sp.Category,
+		&sp.RequiredYearsTraining, &sp.CertificationRequired)
+	if err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+func (s *sqlStore) ListFacilityTypes(ctx context.Context, filters Filters) ([]FacilityType, error) {
+	qb := &queryBuilder{}
+	qb.applyFilters(filters, facilityTypeFilterConds)
+	rows, err := s.query(ctx, "SELECT "+facilityTypeColumns+" FROM facility_types"+qb.whereClause(), qb.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	facilityTypes := []FacilityType{}
+	for rows.Next() {
+		ft, err := scanFacilityType(rows)
+		if err != nil {
+			log.Printf("Error scanning facility type: %v", err)
+			continue
+		}
+		facilityTypes = append(facilityTypes, *ft)
+	}
+	return facilityTypes, rows.Err()
+}
+
+func (s *sqlStore) GetFacilityType(ctx context.Context, id int) (*FacilityType, error) {
+	ft, err := scanFacilityType(s.queryRow(ctx, "SELECT "+facilityTypeColumns+" FROM facility_types WHERE facility_type_id = @p1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return ft, err
+}
+
+func (s *sqlStore) CreateFacilityType(ctx context.Context, in *FacilityTypeInput) (int64, error) {
+	query := s.d.returningID(`INSERT INTO facility_types
+		(type_name, description, typical_bed_capacity, accreditation_required)
+		VALUES (@p1, @p2, @p3, @p4)`, "facility_type_id")
+	var newID int64
+	err := s.queryRow(ctx, query,
+		in.TypeName, in.Description, in.TypicalBedCapacity, in.AccreditationRequired).Scan(&newID)
+	return newID, s.constraintError(err)
+}
+
+func (s *sqlStore) UpdateFacilityType(ctx context.Context, id int, in *FacilityTypeInput) error {
+	query := `UPDATE facility_types
+		SET type_name = @p1,
+			description = @p2,
+			typical_bed_capacity = @p3,
+			accreditation_required = @p4
+		WHERE facility_type_id = @p5`
+	result, err := s.exec(ctx, query,
+		in.TypeName, in.Description, in.TypicalBedCapacity, in.AccreditationRequired, id)
+	return s.checkReferenceUpdate(result, err)
+}
+
+func (s *sqlStore) DeleteFacilityType(ctx context.Context, id int) (map[string]int, error) {
+	return s.deleteReferenced(ctx, "DELETE FROM facility_types WHERE facility_type_id = @p1", id, map[string]string{
+		"departments":     "SELECT COUNT(*) FROM departments WHERE facility_type_id = @p1",
+		"medical_workers": "SELECT COUNT(*) FROM medical_workers WHERE department_id IN (SELECT department_id FROM departments WHERE facility_type_id = @p1)",
+	})
+}
+
+func (s *sqlStore) ListSpecializations(ctx context.Context, filters Filters) ([]Specialization, error) {
+	qb := &queryBuilder{}
+	qb.applyFilters(filters, specializationFilterConds)
+	rows, err := s.query(ctx, "SELECT "+specializationColumns+" FROM specializations"+qb.whereClause(), qb.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	specializations := []Specialization{}
+	for rows.Next() {
+		sp, err := scanSpecialization(rows)
+		if err != nil {
+			log.Printf("Error scanning specialization: %v", err)
+			continue
+		}
+		specializations = append(specializations, *sp)
+	}
+	return specializations, rows.Err()
+}
+
+func (s *sqlStore) GetSpecialization(ctx context.Context, id int) (*Specialization, error) {
+	sp, err := scanSpecialization(s.queryRow(ctx, "SELECT "+specializationColumns+" FROM specializations WHERE specialization_id = @p1", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return sp, err
+}
+
+func (s *sqlStore) CreateSpecialization(ctx context.Context, in *SpecializationInput) (int64, error) {
+	query := s.d.returningID(`INSERT INTO specializations
+		(specialization_name, description, category, required_years_training, certification_required)
+		VALUES (@p1, @p2, @p3, @p4, @p5)`, "specialization_id")
+	var newID int64
+	err := s.queryRow(ctx, query,
+		in.SpecializationName, in.Description, in.Category, in.RequiredYearsTraining, in.CertificationRequired).Scan(&newID)
+	return newID, s.constraintError(err)
+}
+
+func (s *sqlStore) UpdateSpecialization(ctx context.Context, id int, in *SpecializationInput) error {
+	query := `UPDATE specializations
+		SET specialization_name = @p1,
+			description = @p2,
+			category = @p3,
+			required_years_training = @p4,
+			certification_required = @p5
+		WHERE specialization_id = @p6`
+	result, err := s.exec(ctx, query,
+		in.SpecializationName, in.Description, in.Category, in.RequiredYearsTraining, in.CertificationRequired, id)
+	return s.checkReferenceUpdate(result, err)
+}
+
+func (s *sqlStore) DeleteSpecialization(ctx context.Context, id int) (map[string]int, error) {
+	return s.deleteReferenced(ctx, "DELETE FROM specializations WHERE specialization_id = @p1", id, map[string]string{
+		"medical_workers": "SELECT COUNT(*) FROM medical_workers WHERE specialization_id = @p1",
+	})
+}
+
+// checkReferenceUpdate maps the outcome of an unversioned UPDATE by id.
+func (s *sqlStore) checkReferenceUpdate(result sql.Result, err error) error {
+	if err != nil {
+		return s.constraintError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// deleteReferenced runs the delete unless one of the count queries finds
+// referencing rows, in which case the counts are returned with ErrInUse.
+func (s *sqlStore) deleteReferenced(ctx context.Context, deleteQuery string, id int, countQueries map[string]string) (map[string]int, error) {
+	refs := map[string]int{}
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		for table, query := range countQueries {
+			var n int
+			if err := s.queryRow(ctx, query, id).Scan(&n); err != nil {
+				return err
+			}
+			if n > 0 {
+				refs[table] = n
+			}
+		}
+		if len(refs) > 0 {
+			return ErrInUse
+		}
+		result, err := s.exec(ctx, deleteQuery, id)
+		if err != nil {
+			if s.d.isForeignKeyError(err) {
+				return ErrInUse
+			}
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err == ErrInUse && len(refs) > 0 {
+		return refs, err
+	}
+	return nil, err
+}
+
+func (s *sqlStore) RecordAudit(ctx context.Context, e *AuditEntry) error {
+	var requestID, before, after interface{}
+	if e.RequestID != "" {
+		requestID = e.RequestID
+	}
+	if e.Before != nil {
+		before = string(e.Before)
+	}
+	if e.After != nil {
+		after = string(e.After)
+	}
+	_, err := s.exec(ctx, `INSERT INTO audit_log
+		(occurred_at, actor, request_id, entity, entity_id, action, before_data, after_data)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6, @p7, @p8)`,
+		e.OccurredAt, e.Actor, requestID, e.Entity, e.EntityID, e.Action, before, after)
+	return err
+}
+
+func (s *sqlStore) ListAudit(ctx context.Context, filters Filters) ([]AuditEntry, int, error) {
+	qb := &queryBuilder{}
+	qb.applyFilters(filters, auditFilterConds)
+	var total int
+	if err := s.queryRow(ctx, "SELECT COUNT(*) FROM audit_log"+qb.whereClause(), qb.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	limit, ok := filters["limit"].(int)
+	if !ok {
+		limit = defaultPageSize
+	}
+	offset, _ := filters["offset"].(int)
+	query := `SELECT audit_id, occurred_at, actor, request_id, entity, entity_id, action, before_data, after_data
+		FROM audit_log` + qb.whereClause() + " ORDER BY audit_id DESC" + s.d.limitOffset(qb, limit, offset)
+	rows, err := s.query(ctx, query, qb.args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var requestID, before, after sql.NullString
+		if err := rows.Scan(&e.AuditID, &e.OccurredAt, &e.Actor, &requestID, &e.Entity, &e.EntityID,
+			&e.Action, &before, &after); err != nil {
+			return nil, 0, err
+		}
+		e.RequestID = requestID.String
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+func (s *sqlStore) CreateUser(ctx context.Context, username, passwordHash, role string, departments []int) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var id int64
+	err = tx.QueryRowContext(ctx, s.d.returningID("INSERT INTO users (username, password_hash, role) VALUES (@p1, @p2, @p3)", "user_id"),
+		s.args(username, passwordHash, role)...).Scan(&id)
+	if err != nil {
+		if s.d.isUniqueError(err) {
+			return 0, ErrDuplicate
+		}
+		return 0, err
+	}
+	if err := s.setUserDepartments(ctx, tx, int(id), departments); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (s *sqlStore) SetRole(ctx context.Context, username, role string, departments []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var id int
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM users WHERE username = @p1", s.args(username)...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET role = @p1 WHERE user_id = @p2", s.args(role, id)...); err != nil {
+		return err
+	}
+	if err := s.setUserDepartments(ctx, tx, id, departments); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) setUserDepartments(ctx context.Context, tx *sql.Tx, userID int, departments []int) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_departments WHERE user_id = @p1", s.args(userID)...); err != nil {
+		return err
+	}
+	for _, dept := range departments {
+		_, err := tx.ExecContext(ctx, "INSERT INTO user_departments (user_id, department_id) VALUES (@p1, @p2)", s.args(userID, dept)...)
+		if err != nil {
+			if s.d.isForeignKeyError(err) {
+				return ErrInvalidReference
+			}
+			if s.d.isUniqueError(err) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) SetPassword(ctx context.Context, username, passwordHash string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var id int
+	err = tx.QueryRowContext(ctx, "SELECT user_id FROM users WHERE username = @p1", s.args(username)...).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET password_hash = @p1 WHERE user_id = @p2", s.args(passwordHash, id)...); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = @p1", s.args(id)...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetUserByName(ctx context.Context, username string) (*User, error) {
+	var u User
+	err := s.queryRow(ctx, "SELECT user_id, username, role, password_hash FROM users WHERE username = @p1", username).
+		Scan(&u.UserID, &u.Username, &u.Role, &u.PasswordHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *sqlStore) CountUsers(ctx context.Context) (int, error) {
+	var n int
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM users").Scan(&n)
+	return n, err
+}
+
+func (s *sqlStore) CreateSession(ctx context.Context, sess *Session) error {
+	now := dbTime(time.Now())
+	if _, err := s.exec(ctx, "DELETE FROM sessions WHERE expires_at <= @p1", now); err != nil {
+		return err
+	}
+	_, err := s.exec(ctx, `INSERT INTO sessions (session_id, user_id, csrf_token, created_at, expires_at)
+		VALUES (@p1, @p2, @p3, @p4, @p5)`, sess.ID, sess.UserID, sess.CSRFToken, now, sess.ExpiresAt)
+	return err
+}
+
+func (s *sqlStore) GetSession(ctx context.Context, id string, now time.Time) (*Session, error) {
+	sess := Session{ID: id}
+	err := s.queryRow(ctx, `SELECT se.user_id, u.username, u.role, se.csrf_token, se.expires_at
+		FROM sessions se JOIN users u ON u.user_id = se.user_id
+		WHERE se.session_id = @p1 AND se.expires_at > @p2`, id, dbTime(now)).
+		Scan(&sess.UserID, &sess.Username, &sess.Role, &sess.CSRFToken, &sess.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sess.DepartmentIDs, err = s.userDepartments(ctx, sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *sqlStore) userDepartments(ctx context.Context, userID int) ([]int, error) {
+	rows, err := s.query(ctx, "SELECT department_id FROM user_departments WHERE user_id = @p1 ORDER BY department_id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	departments := []int{}
+	for rows.Next() {
+		var dept int
+		if err := rows.Scan(&dept); err != nil {
+			return nil, err
+		}
+		departments = append(departments, dept)
+	}
+	return departments, rows.Err()
+}
+
+func (s *sqlStore) DeleteSession(ctx context.Context, id string) error {
+	_, err := s.exec(ctx, "DELETE FROM sessions WHERE session_id = @p1", id)
+	return err
+}
+
+func (s *sqlStore) CreateAPIToken(ctx context.Context, t *APIToken) (int64, error) {
+	var id int64
+	err := s.queryRow(ctx, s.d.returningID(`INSERT INTO api_tokens
+		(user_id, name, token_hash, scopes, created_at, expires_at)
+		VALUES (@p1, @p2, @p3, @p4, @p5, @p6)`, "token_id"),
+		t.UserID, t.Name, t.Hash, strings.Join(t.Scopes, " "), t.CreatedAt, t.ExpiresAt).Scan(&id)
+	return id, err
+}
+
+func (s *sqlStore) ListAPITokens(ctx context.Context, userID int) ([]APIToken, error) {
+	qb := &queryBuilder{}
+	if userID != 0 {
+		qb.where("t.user_id = ?", userID)
+	}
+	rows, err := s.query(ctx, `SELECT t.token_id, t.user_id, u.username, t.name, t.scopes,
+		t.created_at, t.expires_at, t.last_used_at, t.revoked_at
+		FROM api_tokens t JOIN users u ON u.user_id = t.user_id`+qb.whereClause()+" ORDER BY t.token_id DESC", qb.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		var scopes string
+		if err := rows.Scan(&t.TokenID, &t.UserID, &t.Username, &t.Name, &scopes,
+			&t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Fields(scopes)
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlStore) RevokeAPIToken(ctx context.Context, id int64, userID int) error {
+	query := "UPDATE api_tokens SET revoked_at = @p1 WHERE token_id = @p2 AND revoked_at IS NULL"
+	args := []interface{}{dbTime(time.Now()), id}
+	if userID != 0 {
+		query += " AND user_id = @p3"
+		args = append(args, userID)
+	}
+	result, err := s.exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// tokenUseInterval limits how often last_used_at is written for a token
+// that is used all the time.
+const tokenUseInterval = time.Minute
+
+func (s *sqlStore) TokenSession(ctx context.Context, hash string, now time.Time) (*Session, error) {
+	var sess Session
+	var scopes string
+	err := s.queryRow(ctx, `SELECT t.token_id, t.scopes, u.user_id, u.username, u.role
+		FROM api_tokens t JOIN users u ON u.user_id = t.user_id
+		WHERE t.token_hash = @p1 AND t.revoked_at IS NULL AND t.expires_at > @p2`, hash, dbTime(now)).
+		Scan(&sess.TokenID, &scopes, &sess.UserID, &sess.Username, &sess.Role)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sess.Scopes = strings.Fields(scopes)
+	sess.DepartmentIDs, err = s.userDepartments(ctx, sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.exec(ctx, `UPDATE api_tokens SET last_used_at = @p1
+		WHERE token_id = @p2 AND (last_used_at IS NULL OR last_used_at < @p3)`,
+		dbTime(now), sess.TokenID, dbTime(now.Add(-tokenUseInterval)))
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (s *sqlStore) ReportSheets(ctx context.Context) ([]ReportSheet, error) {
+	var sheets []ReportSheet
+	for _, table := range s.d.reportQueries() {
+		sheet, err := querySheet(ctx, s.db, table.name, table.query)
+		if err != nil {
+			log.Printf("Error querying %s: %v", table.name, err)
+			continue
+		}
+		sheets = append(sheets, *sheet)
+	}
+	return sheets, nil
+}
+
+func (s *sqlStore) DepartmentStatistics(ctx context.Context, filters Filters) ([]DepartmentStat, error) {
+	rows, err := s.query(ctx, s.d.departmentStatistics(), filters["department_id"], filters["facility_type_id"])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := []DepartmentStat{}
+	for rows.Next() {
+		var st DepartmentStat
+		err := rows.Scan(&st.DepartmentID, &st.DepartmentName, &st.FacilityType, &st.DepartmentHead,
+			&st.Location, &st.PhoneNumber, &st.CreatedDate, &st.TotalWorkers,
+			&st.AvgSalary, &st.MinSalary, &st.MaxSalary, &st.TotalSalaryBudget,
+			&st.EarliestHireDate, &st.LatestHireDate, &st.UniqueSpecializations,
+			&st.AvgYearsExperience, &st.MostCommonSpecialization)
+		if err != nil {
+			log.Printf("Error scanning department statistics: %v", err)
+			continue
+		}
+		stats = append(stats, st)
+	}
+	return stats, rows.Err()
+}
+
+// querySheet reads a whole result set with the driver's own value types.
+func querySheet(ctx context.Context, db *sql.DB, name, query string) (*ReportSheet, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sheet := &ReportSheet{Name: name}
+	if sheet.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	for _, ct := range colTypes {
+		sheet.Types = append(sheet.Types, ct.DatabaseTypeName())
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(sheet.Columns))
+		valuePtrs := make([]interface{}, len(sheet.Columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := rows.Scan(valuePtrs...); err != nil {
+			log.Printf("Error scanning row for %s: %v", name, err)
+			continue
+		}
+		sheet.Rows = append(sheet.Rows, values)
+	}
+	return sheet, rows.Err()
+}
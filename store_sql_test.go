@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// newTestStore returns a store on a new in-memory SQLite database with every
+// migration applied, the demo data included: seven departments of two
+// workers each.
+func newTestStore(t *testing.T) *sqlStore {
+	t.Helper()
+	db, err := openSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store := newSQLiteStore(db)
+	migrations, err := newMigrator(store, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrations.up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestHistoryTime(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"2018-03-15", "2018-03-15T00:00:00.000Z"},
+		{"2026-10-17 05:35:42.520", "2026-10-17T05:35:42.520Z"},
+		{"2026-10-17 05:35:42", "2026-10-17T05:35:42.000Z"},
+		{"2018-03-15T00:00:00Z", "2018-03-15T00:00:00.000Z"},
+		{"2026-10-17T05:35:42.5201234Z", "2026-10-17T05:35:42.520Z"},
+		{"2026-10-17T08:35:42.52+03:00", "2026-10-17T05:35:42.520Z"},
+		{"yesterday", "yesterday"},
+	}
+	for _, tt := range tests {
+		if got := historyTime(tt.in); got != tt.want {
+			t.Errorf("historyTime(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, tt := range tests[:6] {
+		if _, err := parseTimeTo(historyTime(tt.in)); err != nil {
+			t.Errorf("as_of rejects %q: %v", historyTime(tt.in), err)
+		}
+	}
+}
+
+// departmentState is what a department deletion may change.
+type departmentState struct {
+	departments int
+	workers     map[int]int
+	versions    map[int]string
+	history     int
+}
+
+func readDepartmentState(t *testing.T, store *sqlStore) departmentState {
+	t.Helper()
+	ctx := context.Background()
+	st := departmentState{workers: map[int]int{}, versions: map[int]string{}}
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM departments").Scan(&st.departments); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM medical_workers_history").Scan(&st.history); err != nil {
+		t.Fatal(err)
+	}
+	page, err := store.ListWorkers(ctx, Filters{"include_archived": true}, &pageRequest{sort: []sortKey{{column: "worker_id"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mw := range page.Workers {
+		st.workers[mw.WorkerID] = mw.DepartmentID
+		st.versions[mw.WorkerID] = mw.RowVersion
+	}
+	if len(st.workers) != 14 {
+		t.Fatalf("%d workers, want the 14 of the demo data", len(st.workers))
+	}
+	return st
+}
+
+func TestDeleteDepartment(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("refused with workers", func(t *testing.T) {
+		store := newTestStore(t)
+		// An archived worker counts as well.
+		if err := store.DeleteWorker(ctx, 1, ""); err != nil {
+			t.Fatal(err)
+		}
+		before := readDepartmentState(t, store)
+		workers, err := store.DeleteDepartment(ctx, 1, 0, false)
+		if err != ErrInUse || len(workers) != 2 {
+			t.Fatalf("got %d workers, %v; want 2 and ErrInUse", len(workers), err)
+		}
+		if after := readDepartmentState(t, store); !reflect.DeepEqual(before, after) {
+			t.Errorf("refused deletion changed %+v to %+v", before, after)
+		}
+	})
+
+	t.Run("dry runs are read-only", func(t *testing.T) {
+		store := newTestStore(t)
+		before := readDepartmentState(t, store)
+		tests := []struct {
+			id, reassignTo int
+			err            error
+		}{
+			{1, 0, ErrInUse},
+			{1, 2, nil},
+			{1, 1, ErrInvalidReference},
+			{1, 999, ErrInvalidReference},
+			{999, 2, ErrNotFound},
+		}
+		for _, tt := range tests {
+			workers, err := store.DeleteDepartment(ctx, tt.id, tt.reassignTo, true)
+			if err != tt.err {
+				t.Errorf("dry run of %d to %d: %v, want %v", tt.id, tt.reassignTo, err, tt.err)
+			}
+			if tt.err == nil && len(workers) != 2 {
+				t.Errorf("dry run of %d to %d: %d workers, want 2", tt.id, tt.reassignTo, len(workers))
+			}
+		}
+		if after := readDepartmentState(t, store); !reflect.DeepEqual(before, after) {
+			t.Errorf("dry runs changed %+v to %+v", before, after)
+		}
+	})
+
+	t.Run("reassigns every worker", func(t *testing.T) {
+		store := newTestStore(t)
+		if err := store.DeleteWorker(ctx, 1, ""); err != nil {
+			t.Fatal(err)
+		}
+		before := readDepartmentState(t, store)
+		workers, err := store.DeleteDepartment(ctx, 1, 2, false)
+		if err != nil || len(workers) != 2 {
+			t.Fatalf("got %d workers, %v", len(workers), err)
+		}
+		after := readDepartmentState(t, store)
+		if after.departments != before.departments-1 {
+			t.Errorf("%d departments left, want %d", after.departments, before.departments-1)
+		}
+		if len(after.workers) != len(before.workers) {
+			t.Errorf("%d workers left, want %d", len(after.workers), len(before.workers))
+		}
+		for id, dept := range before.workers {
+			want := dept
+			if dept == 1 {
+				want = 2
+			}
+			if after.workers[id] != want {
+				t.Errorf("worker %d in department %d, want %d", id, after.workers[id], want)
+			}
+		}
+		if _, err := store.GetDepartment(ctx, 1); err != ErrNotFound {
+			t.Errorf("deleted department: %v", err)
+		}
+	})
+
+	t.Run("empty department", func(t *testing.T) {
+		store := newTestStore(t)
+		if _, err := store.DeleteDepartment(ctx, 1, 2, false); err != nil {
+			t.Fatal(err)
+		}
+		workers, err := store.DeleteDepartment(ctx, 2, 0, false)
+		if err != ErrInUse || len(workers) != 4 {
+			t.Fatalf("got %d workers, %v", len(workers), err)
+		}
+		id, err := store.CreateDepartment(ctx, &DepartmentInput{DepartmentName: "Empty", FacilityTypeID: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if workers, err := store.DeleteDepartment(ctx, int(id), 0, false); err != nil || len(workers) != 0 {
+			t.Errorf("got %d workers, %v", len(workers), err)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+type sqliteDialect struct{}
+
+func init() {
+	sqlite.MustRegisterScalarFunction("fn_GetWorkerExperience", 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		hireDate, ok := args[0].(string)
+		if !ok {
+			return nil, nil
+		}
+		hired, err := time.Parse("2006-01-02", dateOnly(hireDate))
+		if err != nil {
+			return nil, err
+		}
+		return workerExperience(hired, time.Now()), nil
+	})
+}
+
+// openSQLite opens the database file at path, creating it if needed. The
+// schema is managed by migrations.
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection keeps ":memory:" databases alive and serializes writers.
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	return db, nil
+}
+
+func newSQLiteStore(db *sql.DB) *sqlStore {
+	return &sqlStore{db: db, d: sqliteDialect{}}
+}
+
+// bindArgs names every argument pN, since the driver binds @pN placeholders
+// by name only.
+func (sqliteDialect) bindArgs(args []interface{}) []interface{} {
+	named := make([]interface{}, len(args))
+	for i, arg := range args {
+		named[i] = sql.Named("p"+strconv.Itoa(i+1), arg)
+	}
+	return named
+}
+
+func (sqliteDialect) workerExperience(hireDate string) string {
+	return "fn_GetWorkerExperience(" + hireDate + ")"
+}
+
+func (sqliteDialect) limitOffset(qb *queryBuilder, limit, offset int) string {
+	return " LIMIT " + qb.bind(limit) + " OFFSET " + qb.bind(offset)
+}
+
+func (sqliteDialect) returningID(insert, idColumn string) string {
+	return insert + " RETURNING " + idColumn
+}
+
+func (sqliteDialect) rowVersionArg(rowVersion string) (interface{}, error) {
+	return strconv.ParseInt(strings.TrimPrefix(rowVersion, "0x"), 16, 64)
+}
+
+func (sqliteDialect) rowVersionText(column string) string {
+	return "printf('0x%016X', " + column + ")"
+}
+
+func (sqliteDialect) isForeignKeyError(err error) bool {
+	return strings.Contains(err.Error(), "FOREIGN KEY constraint")
+}
+
+func (sqliteDialect) isUniqueError(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// isTruncationError is always false: SQLite does not enforce VARCHAR sizes.
+func (sqliteDialect) isTruncationError(err error) bool {
+	return false
+}
+
+// sqliteDepartmentStatistics is the body of dbo.sp_GetDepartmentStatistics;
+// where is inserted before GROUP BY.
+func sqliteDepartmentStatistics(where string) string {
+	return `
+SELECT
+    d.department_id,
+    d.department_name,
+    ft.type_name as facility_type,
+    d.department_head,
+    d.location,
+    d.phone_number,
+    d.created_date,
+    COUNT(mw.worker_id) as total_workers,
+    AVG(mw.salary) as avg_salary,
+    MIN(mw.salary) as min_salary,
+    MAX(mw.salary) as max_salary,
+    SUM(mw.salary) as total_salary_budget,
+    MIN(mw.hire_date) as earliest_hire_date,
+    MAX(mw.hire_date) as latest_hire_date,
+    COUNT(DISTINCT mw.specialization_id) as unique_specializations_count,
+    CAST(AVG(CAST(strftime('%Y', 'now') AS INTEGER) - CAST(strftime('%Y', mw.hire_date) AS INTEGER)) AS INTEGER) as avg_years_experience,
+    (SELECT s.specialization_name
+     FROM medical_workers mw2
+              JOIN specializations s ON mw2.specialization_id = s.specialization_id
+     WHERE mw2.department_id = d.department_id AND mw2.deleted_at IS NULL
+     GROUP BY mw2.specialization_id, s.specialization_name
+     ORDER BY COUNT(*) DESC
+     LIMIT 1) as most_common_specialization
+FROM departments d
+         LEFT JOIN facility_types ft ON d.facility_type_id = ft.facility_type_id
+         LEFT JOIN medical_workers mw ON d.department_id = mw.department_id AND mw.deleted_at IS NULL
+` + where + `
+GROUP BY
+    d.department_id,
+    d.department_name,
+    ft.type_name,
+    d.department_head,
+    d.location,
+    d.phone_number,
+    d.created_date
+ORDER BY d.department_name`
+}
+
+func (sqliteDialect) reportQueries() []reportQuery {
+	queries := mssqlDialect{}.reportQueries()
+	queries[len(queries)-1].query = sqliteDepartmentStatistics("")
+	return queries
+}
+
+func (sqliteDialect) departmentStatistics() string {
+	return sqliteDepartmentStatistics(`WHERE (@p1 IS NULL OR d.department_id = @p1)
+  AND (@p2 IS NULL OR d.facility_type_id = @p2)`)
+}
+
+func (sqliteDialect) migrationsTable() string {
+	return `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+}
+
+func (sqliteDialect) migrationForeignKeys() (off, on, check string) {
+	return "PRAGMA foreign_keys = OFF", "PRAGMA foreign_keys = ON", "PRAGMA foreign_key_check"
+}
+
+// workerExperience mirrors dbo.fn_GetWorkerExperience.
+func workerExperience(hired, now time.Time) string {
+	now = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, hired.Location())
+	years := now.Year() - hired.Year()
+	afterYears := hired.AddDate(years, 0, 0)
+	months := (now.Year()-afterYears.Year())*12 + int(now.Month()) - int(afterYears.Month())
+	afterMonths := afterYears.AddDate(0, months, 0)
+	days := int(now.Sub(afterMonths).Hours() / 24)
+	if days < 0 {
+		months--
+		firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, hired.Location())
+		days += firstOfMonth.AddDate(0, 0, -1).Day()
+	}
+	if months < 0 {
+		years--
+		months += 12
+	}
+	plural := func(n int, unit string) string {
+		if n > 1 {
+			return fmt.Sprintf("%d %ss", n, unit)
+		}
+		return fmt.Sprintf("%d %s", n, unit)
+	}
+	switch {
+	case years == 0 && months == 0:
+		return "New hire (< 1 month)"
+	case years == 0:
+		return plural(months, "month")
+	case months == 0:
+		return plural(years, "year")
+	default:
+		return plural(years, "year") + ", " + plural(months, "month")
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// API tokens let other systems call the API without a browser session, with
+// an "Authorization: Bearer mdw_..." header. A token acts as the user who
+// created it, limited to its scopes. A scope is a resource and read or write
+// access, e.g. "workers:read"; write includes read.
+
+const tokenPrefix = "mdw_"
+
+var tokenResources = []string{"workers", "departments", "references", "reports", "audit"}
+
+// scopePermissions are the role permissions needed to grant a scope.
+var scopePermissions = map[string]permission{
+	"workers:write":     permEditWorkers,
+	"departments:write": permEditDepartments,
+	"references:write":  permEditReferences,
+	"audit:read":        permViewAudit,
+}
+
+const (
+	defaultTokenLifetime = 90 * 24 * time.Hour
+	maxTokenLifetime     = 365 * 24 * time.Hour
+)
+
+// routeResource returns the token resource of an API path, "" for the
+// endpoints every token may call.
+func routeResource(path string) string {
+	switch {
+	case strings.HasPrefix(path, "/api/medical-workers"):
+		return "workers"
+	case strings.HasPrefix(path, "/api/departments"), strings.HasPrefix(path, "/api/all-departments"),
+		strings.HasPrefix(path, "/api/department-"):
+		return "departments"
+	case strings.HasPrefix(path, "/api/facility-types"), strings.HasPrefix(path, "/api/specializations"):
+		return "references"
+	case path == "/api/download-report":
+		return "reports"
+	case path == "/api/audit":
+		return "audit"
+	}
+	return ""
+}
+
+// missingScope returns the scope a token request needs but lacks, or "".
+func (sess *Session) missingScope(r *http.Request) string {
+	resource := routeResource(r.URL.Path)
+	if resource == "" {
+		return ""
+	}
+	access := "write"
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		access = "read"
+	}
+	for _, scope := range sess.Scopes {
+		if scope == resource+":"+access || scope == resource+":write" {
+			return ""
+		}
+	}
+	return resource + ":" + access
+}
+
+// bearerToken returns the token of an Authorization header, ok is false
+// when there is no such header.
+func bearerToken(r *http.Request) (token string, ok bool) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return "", false
+	}
+	token, _ = strings.CutPrefix(header, "Bearer ")
+	return strings.TrimSpace(token), true
+}
+
+// checkScopes validates requested scopes against the role of the session
+// and returns them sorted and without duplicates.
+func (sess *Session) checkScopes(v *validator, requested []string) []string {
+	if len(requested) == 0 {
+		v.add("scopes", "must list at least one scope")
+	}
+	seen := map[string]bool{}
+	var scopes []string
+	for _, scope := range requested {
+		resource, access, _ := strings.Cut(scope, ":")
+		if !knownResource(resource) || (access != "read" && access != "write") {
+			v.add("scopes", fmt.Sprintf("%q is not a scope; use <%s>:read or :write",
+				scope, strings.Join(tokenResources, "|")))
+			continue
+		}
+		if p, ok := scopePermissions[scope]; ok && !sess.can(p) {
+			v.add("scopes", scope+" exceeds the permissions of your role")
+			continue
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+func knownResource(resource string) bool {
+	for _, r := range tokenResources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenOwner returns the user whose tokens the caller manages: everyone's
+// for HR, otherwise their own. Tokens cannot manage tokens.
+func tokenOwner(w http.ResponseWriter, r *http.Request) (int, bool) {
+	sess := currentSession(r.Context())
+	if sess.TokenID != 0 {
+		writeError(w, r, forbidden())
+		return 0, false
+	}
+	if sess.can(permManageTokens) {
+		return 0, true
+	}
+	return sess.UserID, true
+}
+
+func (s *server) getAPITokens(w http.ResponseWriter, r *http.Request) {
+	owner, ok := tokenOwner(w, r)
+	if !ok {
+		return
+	}
+	tokens, err := s.tokens.ListAPITokens(r.Context(), owner)
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func (s *server) createAPIToken(w http.ResponseWriter, r *http.Request) {
+	if _, ok := tokenOwner(w, r); !ok {
+		return
+	}
+	var in struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		ExpiresAt string   `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		log.Printf("Error decoding request: %v", err)
+		writeError(w, r, badRequest("Invalid JSON"))
+		return
+	}
+	sess := currentSession(r.Context())
+	now := time.Now()
+	v := &validator{}
+	v.requiredText("name", &in.Name, 50)
+	scopes := sess.checkScopes(v, in.Scopes)
+	expires := now.Add(defaultTokenLifetime)
+	if in.ExpiresAt != "" {
+		if t, err := time.Parse(time.RFC3339, in.ExpiresAt); err == nil {
+			expires = t
+		} else if t, err := time.Parse("2006-01-02", in.ExpiresAt); err == nil {
+			expires = t
+		} else {
+			v.add("expires_at", "must be a date (YYYY-MM-DD) or an RFC 3339 time")
+		}
+		if !expires.After(now) {
+			v.add("expires_at", "must be in the future")
+		} else if expires.After(now.Add(maxTokenLifetime)) {
+			v.add("expires_at", fmt.Sprintf("must be within %d days", int(maxTokenLifetime.Hours()/24)))
+		}
+	}
+	if err := v.err(); err != nil {
+		writeError(w, r, validationFailed(err))
+		return
+	}
+	token := tokenPrefix + randomToken()
+	t := &APIToken{
+		UserID:    sess.UserID,
+		Username:  sess.Username,
+		Name:      in.Name,
+		Scopes:    scopes,
+		CreatedAt: dbTime(now),
+		ExpiresAt: dbTime(expires),
+		Hash:      tokenHash(token),
+	}
+	var err error
+	t.TokenID, err = s.tokens.CreateAPIToken(r.Context(), t)
+	if err != nil {
+		writeError(w, r, internalError("Database error", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "API token created. Store it now, it is not shown again.",
+		"token":      token,
+		"token_id":   t.TokenID,
+		"name":       t.Name,
+		"scopes":     t.Scopes,
+		"expires_at": t.ExpiresAt,
+	})
+}
+
+func (s *server) revokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	owner, ok := tokenOwner(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, r, badRequest("Invalid token ID"))
+		return
+	}
+	if err := s.tokens.RevokeAPIToken(r.Context(), id, owner); err != nil {
+		writeError(w, r, storeError(err, "API token"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API token revoked successfully"})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMissingScope(t *testing.T) {
+	sess := &Session{TokenID: 1, Scopes: []string{"departments:write", "workers:read"}}
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"GET", "/api/medical-workers", ""},
+		{"GET", "/api/medical-workers/1/history", ""},
+		{"HEAD", "/api/medical-workers/1", ""},
+		{"POST", "/api/medical-workers", "workers:write"},
+		{"PATCH", "/api/medical-workers/1", "workers:write"},
+		{"POST", "/api/medical-workers/1/restore", "workers:write"},
+		{"DELETE", "/api/medical-workers/1/image", "workers:write"},
+		{"GET", "/api/all-departments", ""},
+		{"GET", "/api/department-statistics", ""},
+		{"DELETE", "/api/departments/1", ""},
+		{"GET", "/api/specializations", "references:read"},
+		{"PUT", "/api/facility-types/1", "references:write"},
+		{"GET", "/api/download-report", "reports:read"},
+		{"GET", "/api/audit", "audit:read"},
+		{"GET", "/api/session", ""},
+		{"GET", "/api/tokens", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := sess.missingScope(r); got != tt.want {
+			t.Errorf("%s %s: missing %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+// createToken creates an API token through the API and returns it.
+func createToken(t *testing.T, c *testClient, body string) (token string, id int64) {
+	t.Helper()
+	status, resp := c.do("POST", "/api/tokens", body)
+	if status != http.StatusCreated {
+		t.Fatalf("creating token %s: %d %s", body, status, resp)
+	}
+	var created struct {
+		Token   string `json:"token"`
+		TokenID int64  `json:"token_id"`
+	}
+	if err := json.Unmarshal(resp, &created); err != nil {
+		t.Fatal(err)
+	}
+	return created.Token, created.TokenID
+}
+
+// bearer returns a client that sends only the API token, without cookies
+// or a CSRF token.
+func (ts *testServer) bearer(t *testing.T, token string) *testClient {
+	c := ts.client(t)
+	c.token = token
+	return c
+}
+
+func TestTokenScopes(t *testing.T) {
+	ts := newTestServer(t)
+	hr := ts.login(t, "hr")
+	read, _ := createToken(t, hr, `{"name":"reader","scopes":["workers:read"]}`)
+	write, _ := createToken(t, hr, `{"name":"writer","scopes":["workers:write"]}`)
+	reader, writer := ts.bearer(t, read), ts.bearer(t, write)
+
+	tests := []struct {
+		c            *testClient
+		method, path string
+		status       int
+		code         string
+	}{
+		{reader, "GET", "/api/medical-workers/1", http.StatusOK, ""},
+		{reader, "GET", "/api/session", http.StatusOK, ""},
+		{reader, "DELETE", "/api/medical-workers/1", http.StatusForbidden, "INSUFFICIENT_SCOPE"},
+		{reader, "POST", "/api/medical-workers/1/restore", http.StatusForbidden, "INSUFFICIENT_SCOPE"},
+		{reader, "GET", "/api/all-departments", http.StatusForbidden, "INSUFFICIENT_SCOPE"},
+		{reader, "GET", "/api/audit", http.StatusForbidden, "INSUFFICIENT_SCOPE"},
+		{reader, "GET", "/api/download-report", http.StatusForbidden, "INSUFFICIENT_SCOPE"},
+		{writer, "GET", "/api/medical-workers/1", http.StatusOK, ""},
+		{writer, "DELETE", "/api/departments/1", http.StatusForbidden, "INSUFFICIENT_SCOPE"},
+		// Token requests carry no CSRF token and need none.
+		{writer, "DELETE", "/api/medical-workers/1", http.StatusOK, ""},
+		{writer, "POST", "/api/medical-workers/1/restore", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		status, body := tt.c.do(tt.method, tt.path, "")
+		if status != tt.status || (tt.code != "" && errorCode(body) != tt.code) {
+			t.Errorf("%s %s with %s: %d %s, want %d %s", tt.method, tt.path, tt.c.token, status, body, tt.status, tt.code)
+		}
+	}
+	if status, body := reader.do("GET", "/api/medical-workers/1", ""); status != http.StatusOK {
+		t.Fatalf("worker 1 after restore: %d %s", status, body)
+	}
+
+	// A bearer header wins over the cookie: a bad token is not replaced by
+	// the session.
+	for _, token := range []string{"mdw_" + randomToken(), randomToken(), read[:len(read)-1]} {
+		c := *hr
+		c.token = token
+		if status, body := c.do("GET", "/api/medical-workers/1", ""); status != http.StatusUnauthorized {
+			t.Errorf("bad token %q with a session: %d %s", token, status, body)
+		}
+	}
+}
+
+func TestTokensStayWithinRole(t *testing.T) {
+	ts := newTestServer(t)
+	reception := ts.login(t, "reception")
+	for _, scopes := range []string{`["workers:write"]`, `["audit:read"]`, `["workers:read","references:write"]`, `["workers:admin"]`, `[]`} {
+		status, body := reception.do("POST", "/api/tokens", `{"name":"t","scopes":`+scopes+`}`)
+		if status != http.StatusUnprocessableEntity {
+			t.Errorf("receptionist token with %s: %d %s", scopes, status, body)
+		}
+	}
+	read, _ := createToken(t, reception, `{"name":"reader","scopes":["workers:read","workers:read","reports:read"]}`)
+	reader := ts.bearer(t, read)
+	for _, path := range []string{"/api/medical-workers/1", "/api/medical-workers"} {
+		for _, obj := range getObjects(t, reader, path) {
+			if keys := hiddenKeys(obj); len(keys) != 0 {
+				t.Errorf("receptionist token got %v from %s", keys, path)
+			}
+		}
+	}
+
+	head := ts.login(t, "head")
+	headRead, _ := createToken(t, head, `{"name":"reader","scopes":["workers:read"]}`)
+	for _, obj := range getObjects(t, ts.bearer(t, headRead), "/api/medical-workers") {
+		if obj["department_id"] != 1.0 {
+			t.Errorf("department head token listed department %v", obj["department_id"])
+		}
+	}
+
+	// The token acts with the role its owner has now: a write scope does not
+	// outlive a demotion.
+	hr := ts.login(t, "hr")
+	write, _ := createToken(t, hr, `{"name":"writer","scopes":["workers:write"]}`)
+	if err := ts.store.SetRole(context.Background(), "hr", roleReceptionist, nil); err != nil {
+		t.Fatal(err)
+	}
+	writer := ts.bearer(t, write)
+	if status, body := writer.do("DELETE", "/api/medical-workers/1", ""); status != http.StatusForbidden || errorCode(body) != "FORBIDDEN" {
+		t.Errorf("token of a demoted user: %d %s", status, body)
+	}
+	if obj := getObjects(t, writer, "/api/medical-workers/1")[0]; len(hiddenKeys(obj)) != 0 {
+		t.Errorf("token of a demoted user got %v", hiddenKeys(obj))
+	}
+
+	// Nor does a scope stored past the checks.
+	id, err := ts.store.CreateAPIToken(context.Background(), &APIToken{
+		UserID: 3, Name: "forged", Scopes: []string{"workers:write"},
+		CreatedAt: dbTime(time.Now()), ExpiresAt: dbTime(time.Now().Add(time.Hour)), Hash: tokenHash("mdw_forged"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := ts.bearer(t, "mdw_forged").do("DELETE", "/api/medical-workers/2", ""); status != http.StatusForbidden {
+		t.Errorf("token %d of a receptionist with workers:write: %d %s", id, status, body)
+	}
+}
+
+func TestTokensCannotManageTokens(t *testing.T) {
+	ts := newTestServer(t)
+	hr := ts.login(t, "hr")
+	token, id := createToken(t, hr, `{"name":"all","scopes":["workers:write","departments:write","references:write","reports:read","audit:read"]}`)
+	c := ts.bearer(t, token)
+	for _, req := range []struct{ method, path, body string }{
+		{"GET", "/api/tokens", ""},
+		{"POST", "/api/tokens", `{"name":"more","scopes":["workers:read"]}`},
+		{"DELETE", "/api/tokens/" + strconv.FormatInt(id, 10), ""},
+	} {
+		if status, body := c.do(req.method, req.path, req.body); status != http.StatusForbidden || errorCode(body) != "FORBIDDEN" {
+			t.Errorf("%s %s with a token: %d %s", req.method, req.path, status, body)
+		}
+	}
+	if status, _ := c.do("GET", "/api/medical-workers/1", ""); status != http.StatusOK {
+		t.Fatalf("token refused after its own revocation was rejected: %d", status)
+	}
+
+	// The session still manages tokens, and needs the CSRF token to.
+	noCSRF := *hr
+	noCSRF.csrf = ""
+	path := "/api/tokens/" + strconv.FormatInt(id, 10)
+	if status, _ := noCSRF.do("DELETE", path, ""); status != http.StatusForbidden {
+		t.Errorf("revoking without the CSRF token: %d", status)
+	}
+	if status, body := hr.do("DELETE", path, ""); status != http.StatusOK {
+		t.Fatalf("revoking: %d %s", status, body)
+	}
+	if status, body := c.do("GET", "/api/medical-workers/1", ""); status != http.StatusUnauthorized {
+		t.Errorf("revoked token: %d %s", status, body)
+	}
+}
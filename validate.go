@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// validator collects every problem with a payload so that they can be
+// reported together. Text checks trim the value in place; limits follow the
+// column sizes of the schema.
+type validator struct {
+	errs FieldErrors
+}
+
+func (v *validator) add(field, message string) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: message})
+}
+
+// err returns the collected problems as FieldErrors, or nil.
+func (v *validator) err() error {
+	return v.errs.orNil()
+}
+
+func (v *validator) requiredText(field string, value *string, max int) {
+	*value = strings.TrimSpace(*value)
+	if *value == "" {
+		v.add(field, "is required")
+		return
+	}
+	v.optionalText(field, value, max)
+}
+
+func (v *validator) optionalText(field string, value *string, max int) {
+	if value == nil {
+		return
+	}
+	*value = strings.TrimSpace(*value)
+	if len(*value) > max {
+		v.add(field, fmt.Sprintf("must be at most %d characters", max))
+	}
+}
+
+func (v *validator) positiveID(field string, id int) {
+	if id <= 0 {
+		v.add(field, "must be a positive integer")
+	}
+}
+
+func (v *validator) nonNegative(field string, value *int) {
+	if value != nil && *value < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+var phonePattern = regexp.MustCompile(`^[0-9+()\-. ]+$`)
+
+func (v *validator) phone(field string, value *string) {
+	v.optionalText(field, value, 20)
+	if value != nil && *value != "" && !phonePattern.MatchString(*value) {
+		v.add(field, "may contain only digits, spaces and + ( ) - .")
+	}
+}
+
+// maxSalary is the largest value of a DECIMAL(10,2) column.
+const maxSalary = 99999999.99
+
+func (in *WorkerInput) validate(now time.Time) error {
+	v := &validator{}
+	v.requiredText("first_name", &in.FirstName, 50)
+	v.requiredText("last_name", &in.LastName, 50)
+	v.requiredText("email", &in.Email, 100)
+	if in.Email != "" {
+		if addr, err := mail.ParseAddress(in.Email); err != nil || addr.Address != in.Email {
+			v.add("email", "must be a valid email address")
+		}
+	}
+	v.phone("phone_number", &in.PhoneNumber)
+	v.positiveID("department_id", in.DepartmentID)
+	v.positiveID("specialization_id", in.SpecializationID)
+	in.HireDate = strings.TrimSpace(in.HireDate)
+	if in.HireDate == "" {
+		v.add("hire_date", "is required")
+	} else if hired, err := time.Parse("2006-01-02", dateOnly(in.HireDate)); err != nil {
+		v.add("hire_date", "must be a date in YYYY-MM-DD format")
+	} else if hired.After(now) {
+		v.add("hire_date", "must not be in the future")
+	} else if hired.Year() < 1900 {
+		v.add("hire_date", "must not be before 1900")
+	} else {
+		in.HireDate = hired.Format("2006-01-02")
+	}
+	if in.Salary < 0 {
+		v.add("salary", "must not be negative")
+	} else if in.Salary > maxSalary {
+		v.add("salary", fmt.Sprintf("must not exceed %.2f", maxSalary))
+	}
+	v.requiredText("license_number", &in.LicenseNumber, 50)
+	return v.err()
+}
+
+func (in *DepartmentInput) validate() error {
+	v := &validator{}
+	v.requiredText("department_name", &in.DepartmentName, 100)
+	v.optionalText("department_head", in.DepartmentHead, 100)
+	v.optionalText("location", in.Location, 100)
+	v.phone("phone_number", in.PhoneNumber)
+	v.positiveID("facility_type_id", in.FacilityTypeID)
+	return v.err()
+}
+
+func (in *FacilityTypeInput) validate() error {
+	v := &validator{}
+	v.requiredText("type_name", &in.TypeName, 50)
+	v.optionalText("description", in.Description, 200)
+	v.nonNegative("typical_bed_capacity", in.TypicalBedCapacity)
+	if in.AccreditationRequired == nil {
+		required := true
+		in.AccreditationRequired = &required
+	}
+	return v.err()
+}
+
+func (in *SpecializationInput) validate() error {
+	v := &validator{}
+	v.requiredText("specialization_name", &in.SpecializationName, 100)
+	v.optionalText("category", in.Category, 50)
+	v.nonNegative("required_years_training", in.RequiredYearsTraining)
+	if in.CertificationRequired == nil {
+		required := true
+		in.CertificationRequired = &required
+	}
+	return v.err()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validWorker() WorkerInput {
+	return WorkerInput{
+		FirstName:        "Пётр",
+		LastName:         "Иванов",
+		Email:            "ivanov@example.com",
+		PhoneNumber:      "+7 (495) 123-45-67",
+		DepartmentID:     1,
+		SpecializationID: 2,
+		HireDate:         "2020-03-01",
+		Salary:           75000,
+		LicenseNumber:    "LIC-1",
+	}
+}
+
+func fieldsOf(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var errs FieldErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error %v is not FieldErrors", err)
+	}
+	var fields []string
+	for _, fe := range errs {
+		fields = append(fields, fe.Field)
+	}
+	return fields
+}
+
+func TestWorkerInputValidate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		change func(in *WorkerInput)
+		fields []string
+	}{
+		{"valid", func(in *WorkerInput) {}, nil},
+		{"no phone", func(in *WorkerInput) { in.PhoneNumber = "" }, nil},
+		{"hire date with time", func(in *WorkerInput) { in.HireDate = "2020-03-01T00:00:00Z" }, nil},
+		{"hired today", func(in *WorkerInput) { in.HireDate = "2024-06-01" }, nil},
+		{"blank names", func(in *WorkerInput) { in.FirstName, in.LastName = " ", "" }, []string{"first_name", "last_name"}},
+		{"long name", func(in *WorkerInput) { in.FirstName = strings.Repeat("a", 51) }, []string{"first_name"}},
+		{"bad email", func(in *WorkerInput) { in.Email = "ivanov" }, []string{"email"}},
+		{"email with name", func(in *WorkerInput) { in.Email = "Ivanov <ivanov@example.com>" }, []string{"email"}},
+		{"bad phone", func(in *WorkerInput) { in.PhoneNumber = "call me" }, []string{"phone_number"}},
+		{"long phone", func(in *WorkerInput) { in.PhoneNumber = strings.Repeat("1", 21) }, []string{"phone_number"}},
+		{"zero ids", func(in *WorkerInput) { in.DepartmentID, in.SpecializationID = 0, -1 }, []string{"department_id", "specialization_id"}},
+		{"no hire date", func(in *WorkerInput) { in.HireDate = "" }, []string{"hire_date"}},
+		{"bad hire date", func(in *WorkerInput) { in.HireDate = "01.03.2020" }, []string{"hire_date"}},
+		{"future hire date", func(in *WorkerInput) { in.HireDate = "2024-06-02" }, []string{"hire_date"}},
+		{"old hire date", func(in *WorkerInput) { in.HireDate = "1899-12-31" }, []string{"hire_date"}},
+		{"negative salary", func(in *WorkerInput) { in.Salary = -1 }, []string{"salary"}},
+		{"huge salary", func(in *WorkerInput) { in.Salary = 1e8 }, []string{"salary"}},
+		{"no license", func(in *WorkerInput) { in.LicenseNumber = "" }, []string{"license_number"}},
+	}
+	for _, tt := range tests {
+		in := validWorker()
+		tt.change(&in)
+		if got := fieldsOf(t, in.validate(now)); !reflect.DeepEqual(got, tt.fields) {
+			t.Errorf("%s: errors for %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
+
+func TestWorkerInputValidateNormalizes(t *testing.T) {
+	in := validWorker()
+	in.FirstName = "  Пётр "
+	in.HireDate = " 2020-03-01T00:00:00Z "
+	if err := in.validate(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if in.FirstName != "Пётр" || in.HireDate != "2020-03-01" {
+		t.Errorf("got %q and %q", in.FirstName, in.HireDate)
+	}
+}
+
+func TestReferenceInputValidate(t *testing.T) {
+	text := func(s string) *string { return &s }
+	number := func(n int) *int { return &n }
+	tests := []struct {
+		name   string
+		in     interface{ validate() error }
+		fields []string
+	}{
+		{"department", &DepartmentInput{DepartmentName: "Хирургия", FacilityTypeID: 1}, nil},
+		{"department blank", &DepartmentInput{DepartmentName: " ", PhoneNumber: text("x"), FacilityTypeID: 0},
+			[]string{"department_name", "phone_number", "facility_type_id"}},
+		{"department long location", &DepartmentInput{DepartmentName: "Хирургия", Location: text(strings.Repeat("a", 101)), FacilityTypeID: 1},
+			[]string{"location"}},
+		{"facility type", &FacilityTypeInput{TypeName: "Больница", TypicalBedCapacity: number(0)}, nil},
+		{"facility type negative beds", &FacilityTypeInput{TypeName: "", TypicalBedCapacity: number(-1)},
+			[]string{"type_name", "typical_bed_capacity"}},
+		{"specialization", &SpecializationInput{SpecializationName: "Хирург"}, nil},
+		{"specialization bad", &SpecializationInput{Category: text(strings.Repeat("a", 51)), RequiredYearsTraining: number(-2)},
+			[]string{"specialization_name", "category", "required_years_training"}},
+	}
+	for _, tt := range tests {
+		if got := fieldsOf(t, tt.in.validate()); !reflect.DeepEqual(got, tt.fields) {
+			t.Errorf("%s: errors for %v, want %v", tt.name, got, tt.fields)
+		}
+	}
+}
+
+// TestAddWorkerReportsAllErrors checks that one request gets every problem
+// back in a single 422, before the store is touched.
+func TestAddWorkerReportsAllErrors(t *testing.T) {
+	s := &server{}
+	body := `{"first_name":"","email":"nope","phone_number":"abc","department_id":0,
+		"specialization_id":3,"hire_date":"tomorrow","salary":-5,"license_number":"L"}`
+	r := httptest.NewRequest("POST", "/api/medical-workers", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), sessionKey, &Session{Role: roleHR}))
+	w := httptest.NewRecorder()
+	s.addMedicalWorker(w, r)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status %d, want 422: %s", w.Code, w.Body)
+	}
+	var resp APIError
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for _, fe := range resp.Fields {
+		fields = append(fields, fe.Field)
+	}
+	want := []string{"first_name", "last_name", "email", "phone_number", "department_id", "hire_date", "salary"}
+	if resp.Code != "VALIDATION_ERROR" || !reflect.DeepEqual(fields, want) {
+		t.Errorf("got %s with errors for %v, want %v", resp.Code, fields, want)
+	}
+}